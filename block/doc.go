@@ -0,0 +1,18 @@
+// package block validates ethereum block bodies against their headers.
+//
+// A header commits to the body of its block through several fields that are
+// derived from it:
+//
+// 1. TxHash: the root of the transactions trie.
+//
+// 2. ReceiptHash: the root of the receipts trie.
+//
+// 3. WithdrawalsHash: the root of the withdrawals trie, since Shanghai.
+//
+// 4. Bloom: the OR of the Bloom fields of all receipts.
+//
+// 5. GasUsed: the cumulative gas used by the last receipt.
+//
+// The tries are built with package patricia, so blocks received from
+// untrusted sources can be checked without a node.
+package block
@@ -0,0 +1,205 @@
+package block
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// ErrMismatch is the error of every Mismatch, see Validate.
+	ErrMismatch = fmt.Errorf("header doesn't match body")
+	// ErrReceiptCount is returned when there isn't exactly one receipt
+	// per transaction.
+	ErrReceiptCount = fmt.Errorf("receipt count doesn't match transaction count")
+	// ErrNoHeader is returned when validating a body without a header.
+	ErrNoHeader = fmt.Errorf("no header")
+	// ErrIncompleteWithdrawal is returned when decoding a withdrawal that
+	// lacks some of its fields.
+	ErrIncompleteWithdrawal = fmt.Errorf("withdrawal is missing fields")
+)
+
+// Withdrawal is a withdrawal from the beacon chain, see EIP-4895.
+// The go-ethereum version this module builds against predates Shanghai, so
+// the type is defined here, with the same consensus encoding.
+type Withdrawal struct {
+	Index     uint64
+	Validator uint64
+	Address   common.Address
+	// Amount is in gwei.
+	Amount uint64
+}
+
+// withdrawalJSON is the JSON encoding of a Withdrawal, as returned by
+// eth_getBlockByNumber, which encodes integers as hex strings.
+type withdrawalJSON struct {
+	Index     *hexutil.Uint64 `json:"index"`
+	Validator *hexutil.Uint64 `json:"validatorIndex"`
+	Address   *common.Address `json:"address"`
+	Amount    *hexutil.Uint64 `json:"amount"`
+}
+
+// MarshalJSON encodes w as returned by eth_getBlockByNumber.
+func (w Withdrawal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(withdrawalJSON{
+		Index:     (*hexutil.Uint64)(&w.Index),
+		Validator: (*hexutil.Uint64)(&w.Validator),
+		Address:   &w.Address,
+		Amount:    (*hexutil.Uint64)(&w.Amount),
+	})
+}
+
+// UnmarshalJSON decodes a withdrawal as returned by eth_getBlockByNumber.
+// All fields are required.
+func (w *Withdrawal) UnmarshalJSON(input []byte) error {
+	var dec withdrawalJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Index == nil || dec.Validator == nil || dec.Address == nil || dec.Amount == nil {
+		return fmt.Errorf("%w: %s", ErrIncompleteWithdrawal, input)
+	}
+	w.Index = uint64(*dec.Index)
+	w.Validator = uint64(*dec.Validator)
+	w.Address = *dec.Address
+	w.Amount = uint64(*dec.Amount)
+	return nil
+}
+
+// Withdrawals implements types.DerivableList, so that the withdrawals root
+// can be computed with types.DeriveSha.
+type Withdrawals []*Withdrawal
+
+// Len implements types.DerivableList
+func (ws Withdrawals) Len() int {
+	return len(ws)
+}
+
+// EncodeIndex implements types.DerivableList
+// Withdrawals are encoded as rlp([index, validator, address, amount]).
+func (ws Withdrawals) EncodeIndex(i int, w *bytes.Buffer) {
+	// encoding a struct of integers and an address can't fail.
+	_ = rlp.Encode(w, ws[i])
+}
+
+// Header is a block header along with the withdrawals root of post-Shanghai
+// blocks, which types.Header lacks for the same reason as Withdrawal.
+type Header struct {
+	*types.Header
+	// WithdrawalsHash is nil for blocks before Shanghai.
+	WithdrawalsHash *common.Hash `json:"withdrawalsRoot"`
+}
+
+// UnmarshalJSON decodes a header as returned by eth_getBlockByNumber.
+func (h *Header) UnmarshalJSON(input []byte) error {
+	header := new(types.Header)
+	if err := json.Unmarshal(input, header); err != nil {
+		return err
+	}
+	var withdrawals struct {
+		WithdrawalsHash *common.Hash `json:"withdrawalsRoot"`
+	}
+	if err := json.Unmarshal(input, &withdrawals); err != nil {
+		return err
+	}
+	h.Header = header
+	h.WithdrawalsHash = withdrawals.WithdrawalsHash
+	return nil
+}
+
+// Mismatch is a header field whose value isn't the one derived from the
+// body.
+type Mismatch struct {
+	// Field is the name of the header field, e.g TxHash.
+	Field string
+	// Header is the value of the field in the header, Derived the one
+	// derived from the body. A nil value means that the field is absent.
+	Header, Derived any
+}
+
+// Error implements error
+func (m Mismatch) Error() string {
+	return fmt.Sprintf("%s: header has %v, body has %v", m.Field, m.Header, m.Derived)
+}
+
+// Unwrap returns ErrMismatch, so that mismatches can be matched with
+// errors.Is.
+func (m Mismatch) Unwrap() error {
+	return ErrMismatch
+}
+
+// Validate checks every field of header that is derived from the body of
+// the block, i.e its transactions and withdrawals, and from the receipts of
+// its transactions, and reports every field that doesn't match rather than
+// just the first one:
+//
+//   - TxHash, ReceiptHash and WithdrawalsHash are the roots of the tries of
+//     txs, receipts and withdrawals.
+//   - Bloom is the OR of the Bloom fields of the receipts.
+//   - GasUsed is the cumulative gas used by the last receipt.
+//
+// The Bloom of a receipt isn't checked against its logs. Since it is part of
+// the encoding of the receipt, a receipt whose Bloom doesn't match its logs
+// is reported as a ReceiptHash mismatch, along with a Bloom one if the
+// blooms of the receipts don't add up to the one in the header either.
+//
+// Withdrawals must be nil for blocks before Shanghai, whose headers don't
+// have a withdrawals root, and non-nil after, even if the block has none.
+// The returned error is only set if the input can't be validated at all.
+func Validate(header *Header, txs types.Transactions, receipts types.Receipts, withdrawals Withdrawals) ([]Mismatch, error) {
+	if header == nil || header.Header == nil {
+		return nil, ErrNoHeader
+	}
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("%w: %d receipts, %d transactions", ErrReceiptCount, len(receipts), len(txs))
+	}
+
+	var mismatches []Mismatch
+	check := func(field string, inHeader, derived any, equal bool) {
+		if !equal {
+			mismatches = append(mismatches, Mismatch{Field: field, Header: inHeader, Derived: derived})
+		}
+	}
+
+	txHash := types.DeriveSha(txs, patricia.New())
+	check("TxHash", header.TxHash, txHash, txHash == header.TxHash)
+
+	receiptHash := types.DeriveSha(receipts, patricia.New())
+	check("ReceiptHash", header.ReceiptHash, receiptHash, receiptHash == header.ReceiptHash)
+
+	switch {
+	case withdrawals == nil && header.WithdrawalsHash == nil:
+		// a block before Shanghai.
+	case withdrawals == nil:
+		check("WithdrawalsHash", *header.WithdrawalsHash, nil, false)
+	default:
+		withdrawalsHash := types.DeriveSha(withdrawals, patricia.New())
+		if header.WithdrawalsHash == nil {
+			check("WithdrawalsHash", nil, withdrawalsHash, false)
+		} else {
+			check("WithdrawalsHash", *header.WithdrawalsHash, withdrawalsHash, withdrawalsHash == *header.WithdrawalsHash)
+		}
+	}
+
+	var bloom types.Bloom
+	for _, r := range receipts {
+		for i := range bloom {
+			bloom[i] |= r.Bloom[i]
+		}
+	}
+	check("Bloom", header.Bloom, bloom, bloom == header.Bloom)
+
+	var gasUsed uint64
+	if len(receipts) > 0 {
+		gasUsed = receipts[len(receipts)-1].CumulativeGasUsed
+	}
+	check("GasUsed", header.GasUsed, gasUsed, gasUsed == header.GasUsed)
+
+	return mismatches, nil
+}
@@ -0,0 +1,220 @@
+package block_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/block"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	gethTrie "github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/require"
+)
+
+const testdata = "../patricia/testdata/16614538/"
+
+func fromJSON(t *testing.T, path string, v any) {
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(contents, v))
+}
+
+// testBlock returns block 16614538, which is before Shanghai.
+func testBlock(t *testing.T) (*block.Header, types.Transactions, types.Receipts) {
+	header := new(block.Header)
+	fromJSON(t, testdata+"header.json", header)
+	var txs types.Transactions
+	fromJSON(t, testdata+"txs.json", &txs)
+	var receipts types.Receipts
+	fromJSON(t, testdata+"receipts.json", &receipts)
+	return header, txs, receipts
+}
+
+func fields(mismatches []block.Mismatch) (r []string) {
+	for _, m := range mismatches {
+		r = append(r, m.Field)
+	}
+	return r
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("valid block", func(t *testing.T) {
+		header, txs, receipts := testBlock(t)
+		require.Nil(t, header.WithdrawalsHash)
+		mismatches, err := block.Validate(header, txs, receipts, nil)
+		require.NoError(t, err)
+		require.Empty(t, mismatches)
+	})
+
+	t.Run("missing transaction", func(t *testing.T) {
+		header, txs, receipts := testBlock(t)
+		_, err := block.Validate(header, txs[1:], receipts, nil)
+		require.ErrorIs(t, err, block.ErrReceiptCount)
+
+		// the logs of the last receipt are also emitted by earlier ones, so
+		// the bloom stays the same.
+		mismatches, err := block.Validate(header, txs[:len(txs)-1], receipts[:len(receipts)-1], nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"TxHash", "ReceiptHash", "GasUsed"}, fields(mismatches))
+		for _, m := range mismatches {
+			require.True(t, errors.Is(m, block.ErrMismatch))
+		}
+		require.Equal(t, header.GasUsed, mismatches[2].Header)
+		require.Equal(t, receipts[len(receipts)-2].CumulativeGasUsed, mismatches[2].Derived)
+	})
+
+	t.Run("tampered receipt", func(t *testing.T) {
+		header, txs, receipts := testBlock(t)
+		receipts[3].Logs = append(receipts[3].Logs, &types.Log{Address: common.HexToAddress("0xdeadbeef")})
+		// the bloom of the receipt no longer matches its logs, which only
+		// changes its encoding.
+		mismatches, err := block.Validate(header, txs, receipts, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ReceiptHash"}, fields(mismatches))
+
+		receipts[3].Bloom = types.CreateBloom(types.Receipts{receipts[3]})
+		mismatches, err = block.Validate(header, txs, receipts, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ReceiptHash", "Bloom"}, fields(mismatches))
+
+		header, txs, receipts = testBlock(t)
+		receipts[len(receipts)-1].CumulativeGasUsed++
+		mismatches, err = block.Validate(header, txs, receipts, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ReceiptHash", "GasUsed"}, fields(mismatches))
+	})
+
+	t.Run("no header", func(t *testing.T) {
+		_, err := block.Validate(nil, nil, nil, nil)
+		require.ErrorIs(t, err, block.ErrNoHeader)
+	})
+}
+
+func TestValidate_Withdrawals(t *testing.T) {
+	withdrawals := block.Withdrawals{
+		{Index: 0, Validator: 65, Address: common.HexToAddress("0x388c818ca8b9251b393131c08a736a67ccb19297"), Amount: 3221},
+		{Index: 1, Validator: 66, Address: common.HexToAddress("0x388c818ca8b9251b393131c08a736a67ccb19297"), Amount: 2893},
+		{Index: 2, Validator: 67, Address: common.HexToAddress("0xa8c62111e4652b07110a0fc81816303c42632f64"), Amount: 32000000000},
+	}
+
+	// withdrawals are encoded as rlp([index, validator, address, amount]).
+	gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+	for i, w := range withdrawals {
+		key, err := rlp.EncodeToBytes(uint64(i))
+		require.NoError(t, err)
+		value, err := rlp.EncodeToBytes([]any{w.Index, w.Validator, w.Address, w.Amount})
+		require.NoError(t, err)
+		gTrie.Update(key, value)
+	}
+	root := gTrie.Hash()
+
+	header, txs, receipts := testBlock(t)
+	header.WithdrawalsHash = &root
+	mismatches, err := block.Validate(header, txs, receipts, withdrawals)
+	require.NoError(t, err)
+	require.Empty(t, mismatches)
+
+	t.Run("changed withdrawal", func(t *testing.T) {
+		changed := append(block.Withdrawals{}, withdrawals...)
+		changed[1] = &block.Withdrawal{Index: 1, Validator: 66, Address: changed[1].Address, Amount: 2894}
+		mismatches, err := block.Validate(header, txs, receipts, changed)
+		require.NoError(t, err)
+		require.Equal(t, []string{"WithdrawalsHash"}, fields(mismatches))
+		require.Equal(t, root, mismatches[0].Header)
+	})
+
+	t.Run("missing withdrawals", func(t *testing.T) {
+		mismatches, err := block.Validate(header, txs, receipts, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"WithdrawalsHash"}, fields(mismatches))
+		require.Nil(t, mismatches[0].Derived)
+
+		// a block after Shanghai may have no withdrawals, in which case
+		// the root is the one of the empty trie.
+		header.WithdrawalsHash = &types.EmptyRootHash
+		mismatches, err = block.Validate(header, txs, receipts, block.Withdrawals{})
+		require.NoError(t, err)
+		require.Empty(t, mismatches)
+	})
+
+	t.Run("header before Shanghai", func(t *testing.T) {
+		header.WithdrawalsHash = nil
+		mismatches, err := block.Validate(header, txs, receipts, withdrawals)
+		require.NoError(t, err)
+		require.Equal(t, []string{"WithdrawalsHash"}, fields(mismatches))
+		require.Nil(t, mismatches[0].Header)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var fields map[string]any
+		fromJSON(t, testdata+"header.json", &fields)
+		fields["withdrawalsRoot"] = root.Hex()
+		enc, err := json.Marshal(fields)
+		require.NoError(t, err)
+		decoded := new(block.Header)
+		require.NoError(t, json.Unmarshal(enc, decoded))
+		require.Equal(t, &root, decoded.WithdrawalsHash)
+		require.Equal(t, header.TxHash, decoded.TxHash)
+	})
+}
+
+// shanghaiTestdata holds the header and withdrawals of the first block after
+// Shanghai, as written by common/scripts fetch-withdrawals:
+//
+//	go run ./common/scripts fetch-withdrawals \
+//		-out block/testdata/17034870/withdrawals.json \
+//		-header-out block/testdata/17034870/header.json
+const shanghaiTestdata = "testdata/17034870/"
+
+func TestValidate_ShanghaiWithdrawals(t *testing.T) {
+	if _, err := os.Stat(shanghaiTestdata); errors.Is(err, fs.ErrNotExist) {
+		t.Skip("no post-Shanghai block in testdata, see shanghaiTestdata")
+	}
+	header := new(block.Header)
+	fromJSON(t, shanghaiTestdata+"header.json", header)
+	require.NotNil(t, header.WithdrawalsHash)
+	var withdrawals block.Withdrawals
+	fromJSON(t, shanghaiTestdata+"withdrawals.json", &withdrawals)
+	require.NotEmpty(t, withdrawals)
+
+	root := types.DeriveSha(withdrawals, gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase())))
+	require.Equal(t, *header.WithdrawalsHash, root)
+
+	// only the withdrawals root is checked, the body isn't in testdata.
+	mismatches, err := block.Validate(header, nil, nil, withdrawals)
+	require.NoError(t, err)
+	for _, m := range mismatches {
+		require.NotEqual(t, "WithdrawalsHash", m.Field)
+	}
+}
+
+func TestWithdrawal_JSON(t *testing.T) {
+	// eth_getBlockByNumber encodes integers as hex strings.
+	input := `{"index":"0x1","validatorIndex":"0x42","address":"0x388c818ca8b9251b393131c08a736a67ccb19297","amount":"0xb4d"}`
+	expected := &block.Withdrawal{Index: 1, Validator: 66, Address: common.HexToAddress("0x388c818ca8b9251b393131c08a736a67ccb19297"), Amount: 2893}
+
+	var w block.Withdrawal
+	require.NoError(t, json.Unmarshal([]byte(input), &w))
+	require.Equal(t, expected, &w)
+
+	enc, err := json.Marshal(expected)
+	require.NoError(t, err)
+	require.JSONEq(t, input, string(enc))
+
+	var ws block.Withdrawals
+	require.NoError(t, json.Unmarshal([]byte("["+input+"]"), &ws))
+	require.Equal(t, block.Withdrawals{expected}, ws)
+
+	t.Run("invalid", func(t *testing.T) {
+		var w block.Withdrawal
+		// decimal integers aren't accepted.
+		require.Error(t, json.Unmarshal([]byte(`{"index":1,"validatorIndex":"0x42","address":"0x388c818ca8b9251b393131c08a736a67ccb19297","amount":"0xb4d"}`), &w))
+		err := json.Unmarshal([]byte(`{"index":"0x1","validatorIndex":"0x42","address":"0x388c818ca8b9251b393131c08a736a67ccb19297"}`), &w)
+		require.ErrorIs(t, err, block.ErrIncompleteWithdrawal)
+	})
+}
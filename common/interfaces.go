@@ -32,5 +32,20 @@ type MPT interface {
 	types.TrieHasher
 	// Root returns the merkle root (i.e hash) of the entire MPT.
 	Root() []byte
-	ProofFor(key []byte) (proofDB ethdb.KeyValueReader)
+	ProofFor(key []byte) (proofDB ethdb.KeyValueReader, err error)
+	// Copy returns an independent copy of the MPT. Changes made to either
+	// the copy or the original are not visible in the other.
+	Copy() MPT
+	// Err returns the first error that Root, Hash or Update ran into, since
+	// they can't return it. Root returns nil in that case, and Hash the zero
+	// hash. Reset clears the error.
+	Err() error
+}
+
+// SecureMPT is an MPT whose paths are the keccak256 hashes of its keys.
+type SecureMPT interface {
+	MPT
+	// GetKey returns the original key of the given hashed key, if it
+	// is known.
+	GetKey(hashedKey []byte) (key []byte, err error)
 }
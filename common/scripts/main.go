@@ -6,7 +6,10 @@ import (
 	"flag"
 	"math/big"
 	"os"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -71,6 +74,82 @@ func main() {
 			if err != nil {
 				panic(err)
 			}
+		case "fetch-proof":
+			cmd := flag.NewFlagSet("fetch-proof", flag.ExitOnError)
+			blockNumber := cmd.Int64("block-number", -1, "block number to fetch the proof at, the latest block if negative")
+			address := cmd.String("address", "", "address of the account to prove")
+			keys := cmd.String("keys", "", "comma separated storage keys to prove")
+			out := cmd.String("out", "proof.json", "output JSON path of response")
+			headerOut := cmd.String("header-out", "header.json", "output JSON path of the block header, which holds the state root")
+			if err := cmd.Parse(os.Args[2:]); err != nil {
+				panic(err)
+			}
+
+			storageKeys := []string{}
+			if *keys != "" {
+				storageKeys = strings.Split(*keys, ",")
+			}
+			// the header is fetched first, so that the proof is fetched at
+			// its number even if the latest block changes in between.
+			var number *big.Int
+			if *blockNumber >= 0 {
+				number = big.NewInt(*blockNumber)
+			}
+			header, err := ethClient.HeaderByNumber(context.Background(), number)
+			if err != nil {
+				panic(err)
+			}
+			var proof json.RawMessage
+			err = rpcClient.Call(&proof, "eth_getProof", common.HexToAddress(*address), storageKeys, hexutil.EncodeBig(header.Number))
+			if err != nil {
+				panic(err)
+			}
+
+			for path, v := range map[string]any{*out: proof, *headerOut: header} {
+				f, err := os.Create(path)
+				if err != nil {
+					panic(err)
+				}
+				err = json.NewEncoder(f).Encode(v)
+				f.Close()
+				if err != nil {
+					panic(err)
+				}
+			}
+		case "fetch-withdrawals":
+			cmd := flag.NewFlagSet("fetch-withdrawals", flag.ExitOnError)
+			blockNumber := cmd.Int64("block-number", 17034870, "block number to fetch withdrawals for, the first one after Shanghai by default")
+			out := cmd.String("out", "withdrawals.json", "output JSON path of the withdrawals")
+			headerOut := cmd.String("header-out", "header.json", "output JSON path of the block header, which holds the withdrawals root")
+			if err := cmd.Parse(os.Args[2:]); err != nil {
+				panic(err)
+			}
+
+			// the block is fetched as raw JSON, since types.Header drops the
+			// withdrawals root.
+			var block map[string]json.RawMessage
+			err = rpcClient.Call(&block, "eth_getBlockByNumber", hexutil.EncodeBig(big.NewInt(*blockNumber)), false)
+			if err != nil {
+				panic(err)
+			}
+			withdrawals, ok := block["withdrawals"]
+			if !ok {
+				panic("block has no withdrawals, is it before Shanghai?")
+			}
+			delete(block, "withdrawals")
+			delete(block, "transactions")
+
+			for path, v := range map[string]any{*out: withdrawals, *headerOut: block} {
+				f, err := os.Create(path)
+				if err != nil {
+					panic(err)
+				}
+				err = json.NewEncoder(f).Encode(v)
+				f.Close()
+				if err != nil {
+					panic(err)
+				}
+			}
 		}
 	}
 }
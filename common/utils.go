@@ -1,5 +1,14 @@
 package common
 
+import "fmt"
+
+var (
+	ErrInvalidCompactPath = fmt.Errorf("invalid compact-encoded path")
+	// ErrInvalidNibble is returned when a path contains values that
+	// don't fit in a nibble.
+	ErrInvalidNibble = fmt.Errorf("invalid nibble")
+)
+
 func Concat(a, b []byte) (r []byte) {
 	r = append(r, a...)
 	r = append(r, b...)
@@ -18,6 +27,16 @@ func BytesToNibbles(s []byte) (nibbles []byte) {
 	return
 }
 
+// NibblesToBytes is the inverse of BytesToNibbles. It packs pairs of
+// nibbles back into bytes, so the provided slice must be of even length.
+func NibblesToBytes(nibbles []byte) (b []byte) {
+	b = make([]byte, len(nibbles)/2)
+	for i := range b {
+		b[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return
+}
+
 func ExtractCommonPrefix(a, b []byte) (r []byte) {
 	i := 0
 	for i < len(a) && i < len(b) {
@@ -53,7 +72,14 @@ func HasPrefix(seq, prefix []byte) bool {
 //	1       |  0001    |       extension       |       odd
 //	2       |  0010    |   terminating (leaf)  |       even
 //	3       |  0011    |   terminating (leaf)  |       odd
-func CompactEncode(b []byte, isLeaf bool) (r []byte) {
+//
+// ErrInvalidNibble is returned if the path contains values above 0xf.
+func CompactEncode(b []byte, isLeaf bool) (r []byte, err error) {
+	for _, n := range b {
+		if n > 0xf {
+			return nil, fmt.Errorf("%w: %#x", ErrInvalidNibble, n)
+		}
+	}
 	// prefix the provided nibbles depending on the number of nibbles
 	if len(b)%2 == 0 {
 		// even
@@ -62,10 +88,6 @@ func CompactEncode(b []byte, isLeaf bool) (r []byte) {
 		// odd
 		b = append([]byte{1}, b...)
 	}
-	// result must always be of even length
-	if len(b)%2 != 0 {
-		panic("invariant violated")
-	}
 	if isLeaf {
 		b[0] += 2
 	}
@@ -73,5 +95,28 @@ func CompactEncode(b []byte, isLeaf bool) (r []byte) {
 	for i := 0; i < len(b); i += 2 {
 		r = append(r, 16*b[i]+b[i+1])
 	}
-	return
+	return r, nil
+}
+
+// CompactDecode is the inverse of CompactEncode. It strips the flags
+// from the provided compact-encoded path, returning the path as nibbles
+// and whether it belongs to a terminating (leaf) node.
+func CompactDecode(b []byte) (nibbles []byte, isLeaf bool, err error) {
+	if len(b) == 0 {
+		return nil, false, ErrInvalidCompactPath
+	}
+	nibbles = BytesToNibbles(b)
+	flag := nibbles[0]
+	if flag > 3 {
+		return nil, false, fmt.Errorf("%w: unknown flag %d", ErrInvalidCompactPath, flag)
+	}
+	isLeaf = flag >= 2
+	if flag%2 == 0 {
+		// even paths are padded with a zero nibble
+		if nibbles[1] != 0 {
+			return nil, false, fmt.Errorf("%w: non-zero padding", ErrInvalidCompactPath)
+		}
+		return nibbles[2:], isLeaf, nil
+	}
+	return nibbles[1:], isLeaf, nil
 }
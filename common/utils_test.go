@@ -5,17 +5,49 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/butcher-of-blaviken/merkle/common"
 )
 
 func TestCompactEncode(t *testing.T) {
 	path := []byte{1, 2, 3, 4, 5}
-	encoded := common.CompactEncode(path, false)
+	encoded, err := common.CompactEncode(path, false)
+	require.NoError(t, err)
 	assert.Equal(t, "112345", hex.EncodeToString(encoded))
 	path = []byte{0, 1, 2, 3, 4, 5}
-	encoded = common.CompactEncode(path, false)
+	encoded, err = common.CompactEncode(path, false)
+	require.NoError(t, err)
 	assert.Equal(t, "00012345", hex.EncodeToString(encoded))
+	_, err = common.CompactEncode([]byte{1, 0x10}, true)
+	assert.ErrorIs(t, err, common.ErrInvalidNibble)
+}
+
+func TestCompactDecode(t *testing.T) {
+	for _, tc := range []struct {
+		path   []byte
+		isLeaf bool
+	}{
+		{[]byte{1, 2, 3, 4, 5}, false},
+		{[]byte{0, 1, 2, 3, 4, 5}, false},
+		{[]byte{15, 1, 12, 11, 8}, true},
+		{[]byte{0, 15, 1, 12, 11, 8}, true},
+		{[]byte{}, true},
+	} {
+		encoded, err := common.CompactEncode(tc.path, tc.isLeaf)
+		require.NoError(t, err)
+		decoded, isLeaf, err := common.CompactDecode(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, tc.path, decoded)
+		assert.Equal(t, tc.isLeaf, isLeaf)
+	}
+
+	_, _, err := common.CompactDecode(nil)
+	assert.ErrorIs(t, err, common.ErrInvalidCompactPath)
+	_, _, err = common.CompactDecode([]byte{0x40})
+	assert.ErrorIs(t, err, common.ErrInvalidCompactPath)
+	_, _, err = common.CompactDecode([]byte{0x01, 0x23})
+	assert.ErrorIs(t, err, common.ErrInvalidCompactPath)
 }
 
 func TestExtractCommonPrefix(t *testing.T) {
@@ -56,6 +88,12 @@ func TestBytesToNibbles(t *testing.T) {
 	)
 }
 
+func TestNibblesToBytes(t *testing.T) {
+	for _, s := range []string{"firstpath", "secondpath", "", "\x00\xff"} {
+		assert.Equal(t, []byte(s), common.NibblesToBytes(common.BytesToNibbles([]byte(s))))
+	}
+}
+
 func TestHasPrefix(t *testing.T) {
 	assert.True(t, common.HasPrefix([]byte{1, 2, 3, 4, 5}, []byte{1, 2, 3}))
 	assert.True(t, common.HasPrefix([]byte("hello world!"), []byte("hello")))
@@ -0,0 +1,163 @@
+package patricia
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	gethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// ErrProofMismatch is returned when a field of an eth_getProof response
+	// doesn't match the value proven by its merkle proof.
+	ErrProofMismatch = fmt.Errorf("claimed value doesn't match proof")
+	// ErrInvalidStorageKey is returned for storage keys in an eth_getProof
+	// response that aren't hex strings of up to 32 bytes.
+	ErrInvalidStorageKey = fmt.Errorf("invalid storage key")
+)
+
+// AccountProof is an eth_getProof response, see EIP-1186.
+type AccountProof struct {
+	Address gethCommon.Address `json:"address"`
+	// AccountProof are the encoded state trie nodes on the path of
+	// keccak256(Address), root first.
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     gethCommon.Hash `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  gethCommon.Hash `json:"storageHash"`
+	StorageProof []StorageProof  `json:"storageProof"`
+}
+
+// StorageProof is the proof of a single storage slot in an eth_getProof
+// response.
+type StorageProof struct {
+	// Key is the storage slot as it was requested, it may be shorter than
+	// 32 bytes, e.g "0x0".
+	Key   string       `json:"key"`
+	Value *hexutil.Big `json:"value"`
+	// Proof are the encoded storage trie nodes on the path of
+	// keccak256(Key), root first.
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// VerifyAccountProofJSON decodes a JSON eth_getProof response and checks it
+// against the given state root, see VerifyAccountProof.
+func VerifyAccountProofJSON(stateRoot []byte, response []byte) (*AccountProof, error) {
+	// a null response leaves proof nil.
+	var proof *AccountProof
+	if err := json.Unmarshal(response, &proof); err != nil {
+		return nil, err
+	}
+	return proof, VerifyAccountProof(stateRoot, proof)
+}
+
+// VerifyAccountProof checks an eth_getProof response against the given state
+// root. The nonce, balance, storage hash and code hash of the response must
+// be those of the account proven by the account proof, and the value of every
+// storage slot must be the one proven by its proof against the storage hash.
+//
+// Absent accounts and slots are supported: if the proofs show that they are
+// not in their trie, all claimed values must be zero. For absent accounts,
+// the storage hash and the code hash may also be those of empty storage and
+// empty code, since nodes return either.
+func VerifyAccountProof(stateRoot []byte, proof *AccountProof) error {
+	if proof == nil {
+		return fmt.Errorf("%w: no account proof", ErrInvalidProof)
+	}
+	enc, err := VerifyProof(stateRoot, crypto.Keccak256(proof.Address.Bytes()), proofFromNodes(proof.AccountProof))
+	if err != nil {
+		return fmt.Errorf("account %s: %w", proof.Address, err)
+	}
+
+	// an absent account is the same as an empty one.
+	acc := &types.StateAccount{
+		Balance:  new(big.Int),
+		Root:     gethCommon.BytesToHash(emptyRoot),
+		CodeHash: emptyCodeHash,
+	}
+	if enc != nil {
+		if err := rlp.DecodeBytes(enc, acc); err != nil {
+			return fmt.Errorf("%w: account %s: %v", ErrMalformedNode, proof.Address, err)
+		}
+	}
+
+	if uint64(proof.Nonce) != acc.Nonce {
+		return fmt.Errorf("%w: nonce of %s is %d, not %d", ErrProofMismatch, proof.Address, acc.Nonce, proof.Nonce)
+	}
+	if proof.Balance == nil || proof.Balance.ToInt().Cmp(acc.Balance) != 0 {
+		return fmt.Errorf("%w: balance of %s is %s, not %s", ErrProofMismatch, proof.Address, acc.Balance, proof.Balance)
+	}
+	storageHash := proof.StorageHash
+	if enc == nil && storageHash == (gethCommon.Hash{}) {
+		storageHash = acc.Root
+	}
+	if storageHash != acc.Root {
+		return fmt.Errorf("%w: storage hash of %s is %s, not %s", ErrProofMismatch, proof.Address, acc.Root, proof.StorageHash)
+	}
+	codeHash := proof.CodeHash.Bytes()
+	if enc == nil && proof.CodeHash == (gethCommon.Hash{}) {
+		codeHash = acc.CodeHash
+	}
+	if !bytes.Equal(codeHash, acc.CodeHash) {
+		return fmt.Errorf("%w: code hash of %s is %x, not %s", ErrProofMismatch, proof.Address, acc.CodeHash, proof.CodeHash)
+	}
+
+	for _, slot := range proof.StorageProof {
+		if err := verifyStorageProof(acc.Root, &slot); err != nil {
+			return fmt.Errorf("account %s: %w", proof.Address, err)
+		}
+	}
+	return nil
+}
+
+// verifyStorageProof checks the value of a storage slot against the storage
+// root of its account.
+func verifyStorageProof(storageRoot gethCommon.Hash, proof *StorageProof) error {
+	slot, err := storageKey(proof.Key)
+	if err != nil {
+		return err
+	}
+	enc, err := VerifyProof(storageRoot.Bytes(), crypto.Keccak256(slot.Bytes()), proofFromNodes(proof.Proof))
+	if err != nil {
+		return fmt.Errorf("storage slot %s: %w", slot, err)
+	}
+
+	// values are stored as rlp encoded byte strings with leading zeroes
+	// trimmed, absent slots are zero.
+	value := new(big.Int)
+	if enc != nil {
+		_, content, _, err := rlp.Split(enc)
+		if err != nil {
+			return fmt.Errorf("%w: storage slot %s: %v", ErrMalformedNode, slot, err)
+		}
+		value.SetBytes(content)
+	}
+	if proof.Value == nil || proof.Value.ToInt().Cmp(value) != 0 {
+		return fmt.Errorf("%w: storage slot %s is %#x, not %s", ErrProofMismatch, slot, value, proof.Value)
+	}
+	return nil
+}
+
+// storageKey parses a storage key of an eth_getProof response. Keys are
+// hex strings of up to 32 bytes, which may have an odd length and leading
+// zeroes.
+func storageKey(key string) (gethCommon.Hash, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(key, "0x"), "0X")
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	b, err := hex.DecodeString(digits)
+	if err != nil || len(b) > gethCommon.HashLength {
+		return gethCommon.Hash{}, fmt.Errorf("%w: %q", ErrInvalidStorageKey, key)
+	}
+	return gethCommon.BytesToHash(b), nil
+}
@@ -0,0 +1,104 @@
+package patricia_test
+
+import (
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// getProofRoot is the state root the eth_getProof responses in
+// testdata/getproof were made against. The responses were made by geth for
+// a local state holding part of the mainnet genesis allocation, an account
+// with a nonce and a contract with storage, in the format of the RPC API.
+// Responses from a node can be fetched with common/scripts fetch-proof.
+var getProofRoot = common.FromHex("0x4ab9fb5d4dc6542f6acf2064619273716537e6aeda3607f81e0fd74c885ba7f8")
+
+func accountProofFromJSON(t *testing.T, path string) []byte {
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return contents
+}
+
+func TestVerifyAccountProof(t *testing.T) {
+	t.Run("contract", func(t *testing.T) {
+		proof, err := patricia.VerifyAccountProofJSON(getProofRoot, accountProofFromJSON(t, "testdata/getproof/contract.json"))
+		require.NoError(t, err)
+		require.Equal(t, common.HexToAddress("0x00000000219ab540356cbb839cbe05303d7705fa"), proof.Address)
+		require.Equal(t, hexutil.Uint64(1), proof.Nonce)
+		// present slots, and slot 0x64 which is absent.
+		require.Len(t, proof.StorageProof, 4)
+		require.Equal(t, big.NewInt(0x2a), proof.StorageProof[1].Value.ToInt())
+		require.Zero(t, proof.StorageProof[3].Value.ToInt().Sign())
+	})
+
+	t.Run("account without storage", func(t *testing.T) {
+		proof, err := patricia.VerifyAccountProofJSON(getProofRoot, accountProofFromJSON(t, "testdata/getproof/eoa.json"))
+		require.NoError(t, err)
+		require.Equal(t, big.NewInt(1234567890), proof.Balance.ToInt())
+		require.Equal(t, common.BytesToHash(crypto.Keccak256(nil)), proof.CodeHash)
+	})
+
+	t.Run("missing account", func(t *testing.T) {
+		proof, err := patricia.VerifyAccountProofJSON(getProofRoot, accountProofFromJSON(t, "testdata/getproof/missing.json"))
+		require.NoError(t, err)
+		require.Zero(t, proof.Balance.ToInt().Sign())
+
+		// a missing account can't be claimed to hold anything.
+		proof.Balance = (*hexutil.Big)(big.NewInt(1))
+		require.ErrorIs(t, patricia.VerifyAccountProof(getProofRoot, proof), patricia.ErrProofMismatch)
+	})
+
+	t.Run("wrong root", func(t *testing.T) {
+		_, err := patricia.VerifyAccountProofJSON(crypto.Keccak256([]byte("other")), accountProofFromJSON(t, "testdata/getproof/contract.json"))
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("mismatching claims", func(t *testing.T) {
+		for name, tamper := range map[string]func(p *patricia.AccountProof){
+			"nonce":        func(p *patricia.AccountProof) { p.Nonce++ },
+			"balance":      func(p *patricia.AccountProof) { p.Balance = (*hexutil.Big)(big.NewInt(1)) },
+			"code hash":    func(p *patricia.AccountProof) { p.CodeHash = common.Hash{} },
+			"storage hash": func(p *patricia.AccountProof) { p.StorageHash[0] ^= 1 },
+			"storage value": func(p *patricia.AccountProof) {
+				p.StorageProof[1].Value = (*hexutil.Big)(big.NewInt(0x2b))
+			},
+			"absent storage value": func(p *patricia.AccountProof) {
+				p.StorageProof[3].Value = (*hexutil.Big)(big.NewInt(1))
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				proof, err := patricia.VerifyAccountProofJSON(getProofRoot, accountProofFromJSON(t, "testdata/getproof/contract.json"))
+				require.NoError(t, err)
+				tamper(proof)
+				require.ErrorIs(t, patricia.VerifyAccountProof(getProofRoot, proof), patricia.ErrProofMismatch)
+			})
+		}
+	})
+
+	t.Run("storage proof of another slot", func(t *testing.T) {
+		proof, err := patricia.VerifyAccountProofJSON(getProofRoot, accountProofFromJSON(t, "testdata/getproof/contract.json"))
+		require.NoError(t, err)
+		proof.StorageProof[0].Proof = proof.StorageProof[2].Proof
+		require.ErrorIs(t, patricia.VerifyAccountProof(getProofRoot, proof), patricia.ErrMissingNode)
+	})
+
+	t.Run("no proof", func(t *testing.T) {
+		require.ErrorIs(t, patricia.VerifyAccountProof(getProofRoot, nil), patricia.ErrInvalidProof)
+		proof, err := patricia.VerifyAccountProofJSON(getProofRoot, []byte("null"))
+		require.ErrorIs(t, err, patricia.ErrInvalidProof)
+		require.Nil(t, proof)
+	})
+
+	t.Run("invalid storage key", func(t *testing.T) {
+		proof, err := patricia.VerifyAccountProofJSON(getProofRoot, accountProofFromJSON(t, "testdata/getproof/contract.json"))
+		require.NoError(t, err)
+		proof.StorageProof[0].Key = "0xzz"
+		require.ErrorIs(t, patricia.VerifyAccountProof(getProofRoot, proof), patricia.ErrInvalidStorageKey)
+	})
+}
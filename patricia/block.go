@@ -0,0 +1,185 @@
+package patricia
+
+import (
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	gethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// ErrIndexOutOfRange is returned when proving an index that isn't in
+	// the list of transactions or receipts.
+	ErrIndexOutOfRange = fmt.Errorf("index out of range")
+	// ErrNotIncluded is returned when a proof shows that there is no
+	// transaction or receipt at the proven index.
+	ErrNotIncluded = fmt.Errorf("not included in block")
+	// ErrInvalidProof is returned when verifying a nil or incomplete proof,
+	// or an inclusion proof against a nil header.
+	ErrInvalidProof = fmt.Errorf("invalid inclusion proof")
+)
+
+// InclusionProof proves that a transaction or a receipt is included in a
+// block, i.e in the trie whose root is the TxHash or ReceiptHash of the
+// block header. It is self-contained: it can be verified against the header
+// alone, and it can be serialized to JSON.
+type InclusionProof struct {
+	// Index is the position of the transaction or receipt in the block.
+	Index uint64 `json:"index"`
+	// Nodes are the encoded trie nodes on the path of rlp(Index), root
+	// first.
+	Nodes []hexutil.Bytes `json:"nodes"`
+}
+
+// ProveTransaction returns a proof that txs[index] is included in the block
+// whose transactions are txs.
+func ProveTransaction(txs types.Transactions, index int) (*InclusionProof, error) {
+	return proveIndex(txs, index)
+}
+
+// ProveReceipt returns a proof that receipts[index] is included in the block
+// whose receipts are receipts.
+func ProveReceipt(receipts types.Receipts, index int) (*InclusionProof, error) {
+	return proveIndex(receipts, index)
+}
+
+// VerifyTransactionProof checks proof against the TxHash of header and
+// returns the proven transaction.
+func VerifyTransactionProof(header *types.Header, proof *InclusionProof) (*types.Transaction, error) {
+	if header == nil {
+		return nil, fmt.Errorf("%w: no header", ErrInvalidProof)
+	}
+	enc, err := proof.verify(header.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(enc); err != nil {
+		return nil, fmt.Errorf("decoding transaction %d: %w", proof.Index, err)
+	}
+	return tx, nil
+}
+
+// VerifyReceiptProof checks proof against the ReceiptHash of header and
+// returns the proven receipt. Only the consensus fields of the receipt
+// (type, status, cumulative gas used, bloom and logs) are set, see
+// types.Receipts.DeriveFields for the others.
+func VerifyReceiptProof(header *types.Header, proof *InclusionProof) (*types.Receipt, error) {
+	if header == nil {
+		return nil, fmt.Errorf("%w: no header", ErrInvalidProof)
+	}
+	enc, err := proof.verify(header.ReceiptHash)
+	if err != nil {
+		return nil, err
+	}
+	receipt := new(types.Receipt)
+	if err := receipt.UnmarshalBinary(enc); err != nil {
+		return nil, fmt.Errorf("decoding receipt %d: %w", proof.Index, err)
+	}
+	return receipt, nil
+}
+
+// LogProof proves that a log was emitted by a transaction in a block: it
+// proves the receipt of the transaction, which holds the log.
+type LogProof struct {
+	// Receipt proves the receipt that holds the log, its Index is the
+	// position of the transaction in the block.
+	Receipt *InclusionProof `json:"receipt"`
+	// LogIndex is the position of the log in the logs of the receipt.
+	LogIndex uint64 `json:"logIndex"`
+}
+
+// ProveLog returns a proof that the log at logIndex in receipts[receiptIndex]
+// was emitted in the block whose receipts are receipts.
+func ProveLog(receipts types.Receipts, receiptIndex, logIndex int) (*LogProof, error) {
+	receiptProof, err := ProveReceipt(receipts, receiptIndex)
+	if err != nil {
+		return nil, err
+	}
+	if logs := receipts[receiptIndex].Logs; logIndex < 0 || logIndex >= len(logs) {
+		return nil, fmt.Errorf("%w: log %d not in [0, %d)", ErrIndexOutOfRange, logIndex, len(logs))
+	}
+	return &LogProof{Receipt: receiptProof, LogIndex: uint64(logIndex)}, nil
+}
+
+// VerifyLogProof checks proof against the ReceiptHash of header and returns
+// the proven log. The receipt is decoded from its consensus encoding, which
+// is either the legacy RLP list or, for typed transactions (EIP-2930,
+// EIP-1559), the transaction type followed by that list.
+//
+// Along with the address, topics and data, the block number and transaction
+// index of the log are set. Index, the position of the log in the block,
+// isn't, since it depends on the logs of the other receipts. Neither is the
+// block hash: types.Header predates Shanghai, so the hash it computes is
+// wrong for blocks that have a withdrawals root.
+func VerifyLogProof(header *types.Header, proof *LogProof) (*types.Log, error) {
+	if proof == nil {
+		return nil, fmt.Errorf("%w: no proof", ErrInvalidProof)
+	}
+	if proof.Receipt == nil {
+		return nil, fmt.Errorf("%w: no receipt proof", ErrInvalidProof)
+	}
+	receipt, err := VerifyReceiptProof(header, proof.Receipt)
+	if err != nil {
+		return nil, err
+	}
+	if proof.LogIndex >= uint64(len(receipt.Logs)) {
+		return nil, fmt.Errorf("%w: receipt %d has %d logs, no log %d", ErrNotIncluded, proof.Receipt.Index, len(receipt.Logs), proof.LogIndex)
+	}
+	log := receipt.Logs[proof.LogIndex]
+	if header.Number != nil {
+		log.BlockNumber = header.Number.Uint64()
+	}
+	log.TxIndex = uint(proof.Receipt.Index)
+	return log, nil
+}
+
+// proveIndex builds the trie of list, the same way types.DeriveSha does, and
+// returns the proof for the item at index.
+func proveIndex(list types.DerivableList, index int) (*InclusionProof, error) {
+	if index < 0 || index >= list.Len() {
+		return nil, fmt.Errorf("%w: %d not in [0, %d)", ErrIndexOutOfRange, index, list.Len())
+	}
+	m := &mpt{}
+	types.DeriveSha(list, m)
+
+	var nodes nodeList
+	key := rlp.AppendUint64(nil, uint64(index))
+	if err := m.prove(common.BytesToNibbles(key), &nodes); err != nil {
+		return nil, err
+	}
+	return &InclusionProof{Index: uint64(index), Nodes: nodes}, nil
+}
+
+// nodeList collects the nodes written by prove, which are written in the
+// order they're found on the path, root first.
+type nodeList []hexutil.Bytes
+
+// Put implements ethdb.KeyValueWriter
+func (l *nodeList) Put(_, value []byte) error {
+	*l = append(*l, gethCommon.CopyBytes(value))
+	return nil
+}
+
+// Delete implements ethdb.KeyValueWriter
+func (l *nodeList) Delete(_ []byte) error {
+	return nil
+}
+
+// verify checks p against root and returns the encoded item it proves.
+func (p *InclusionProof) verify(root gethCommon.Hash) ([]byte, error) {
+	if p == nil {
+		return nil, fmt.Errorf("%w: no proof", ErrInvalidProof)
+	}
+	value, err := VerifyProof(root.Bytes(), rlp.AppendUint64(nil, p.Index), proofFromNodes(p.Nodes))
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%w: nothing at index %d", ErrNotIncluded, p.Index)
+	}
+	return value, nil
+}
@@ -0,0 +1,240 @@
+package patricia_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionProof(t *testing.T) {
+	for _, block := range []string{"16614538", "10467135"} {
+		t.Run(block, func(t *testing.T) {
+			header := headerFromJSON(t, "testdata/"+block+"/header.json")
+			txs := transactionsFromJSON(t, "testdata/"+block+"/txs.json")
+			// the first items, the ones around 0x7f, where the keys
+			// become longer, and the last one.
+			for _, i := range []int{0, 1, 2, 0x7e, 0x7f, 0x80, 0x81, len(txs) - 1} {
+				if i >= len(txs) {
+					continue
+				}
+				proof, err := patricia.ProveTransaction(txs, i)
+				require.NoError(t, err)
+				tx, err := patricia.VerifyTransactionProof(header, proof)
+				require.NoError(t, err)
+				require.Equal(t, txs[i].Hash(), tx.Hash())
+			}
+		})
+	}
+
+	header := headerFromJSON(t, "testdata/16614538/header.json")
+	txs := transactionsFromJSON(t, "testdata/16614538/txs.json")
+
+	t.Run("json", func(t *testing.T) {
+		proof, err := patricia.ProveTransaction(txs, 17)
+		require.NoError(t, err)
+		enc, err := json.Marshal(proof)
+		require.NoError(t, err)
+		decoded := new(patricia.InclusionProof)
+		require.NoError(t, json.Unmarshal(enc, decoded))
+		tx, err := patricia.VerifyTransactionProof(header, decoded)
+		require.NoError(t, err)
+		require.Equal(t, txs[17].Hash(), tx.Hash())
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		_, err := patricia.ProveTransaction(txs, len(txs))
+		require.ErrorIs(t, err, patricia.ErrIndexOutOfRange)
+		_, err = patricia.ProveTransaction(txs, -1)
+		require.ErrorIs(t, err, patricia.ErrIndexOutOfRange)
+	})
+
+	t.Run("wrong header", func(t *testing.T) {
+		proof, err := patricia.ProveTransaction(txs, 3)
+		require.NoError(t, err)
+		other := headerFromJSON(t, "testdata/10467135/header.json")
+		_, err = patricia.VerifyTransactionProof(other, proof)
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("wrong index", func(t *testing.T) {
+		proof, err := patricia.ProveTransaction(txs, 3)
+		require.NoError(t, err)
+		// the proof holds the path to transaction 3 only.
+		proof.Index = 4
+		_, err = patricia.VerifyTransactionProof(header, proof)
+		require.Error(t, err)
+	})
+
+	t.Run("tampered proof", func(t *testing.T) {
+		proof, err := patricia.ProveTransaction(txs, 3)
+		require.NoError(t, err)
+		last := proof.Nodes[len(proof.Nodes)-1]
+		last[len(last)-1] ^= 1
+		_, err = patricia.VerifyTransactionProof(header, proof)
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("nil proof or header", func(t *testing.T) {
+		// e.g a proof decoded from JSON null.
+		var proof *patricia.InclusionProof
+		require.NoError(t, json.Unmarshal([]byte("null"), &proof))
+		_, err := patricia.VerifyTransactionProof(header, proof)
+		require.ErrorIs(t, err, patricia.ErrInvalidProof)
+
+		proof, err = patricia.ProveTransaction(txs, 3)
+		require.NoError(t, err)
+		_, err = patricia.VerifyTransactionProof(nil, proof)
+		require.ErrorIs(t, err, patricia.ErrInvalidProof)
+	})
+
+	t.Run("absent transaction", func(t *testing.T) {
+		// a block with a single transaction proves that there is no
+		// second one.
+		single := types.Transactions{txs[0]}
+		proof, err := patricia.ProveTransaction(single, 0)
+		require.NoError(t, err)
+		proof.Index = 1
+		_, err = patricia.VerifyTransactionProof(&types.Header{TxHash: types.DeriveSha(single, patricia.New())}, proof)
+		require.ErrorIs(t, err, patricia.ErrNotIncluded)
+	})
+}
+
+func TestReceiptProof(t *testing.T) {
+	header := headerFromJSON(t, "testdata/16614538/header.json")
+	receipts := receiptsFromJSON(t, "testdata/16614538/receipts.json")
+
+	for _, i := range []int{0, 1, 0x7f, 0x80, len(receipts) - 1} {
+		if i >= len(receipts) {
+			continue
+		}
+		proof, err := patricia.ProveReceipt(receipts, i)
+		require.NoError(t, err)
+		receipt, err := patricia.VerifyReceiptProof(header, proof)
+		require.NoError(t, err)
+
+		expected := receipts[i]
+		require.Equal(t, expected.Type, receipt.Type)
+		require.Equal(t, expected.Status, receipt.Status)
+		require.Equal(t, expected.CumulativeGasUsed, receipt.CumulativeGasUsed)
+		require.Equal(t, expected.Bloom, receipt.Bloom)
+		require.Len(t, receipt.Logs, len(expected.Logs))
+		for j, log := range receipt.Logs {
+			require.Equal(t, expected.Logs[j].Address, log.Address)
+			require.Equal(t, expected.Logs[j].Topics, log.Topics)
+			require.Equal(t, expected.Logs[j].Data, log.Data)
+		}
+	}
+
+	t.Run("transaction proof", func(t *testing.T) {
+		// a receipt proof doesn't verify against the transactions root.
+		proof, err := patricia.ProveReceipt(receipts, 0)
+		require.NoError(t, err)
+		_, err = patricia.VerifyTransactionProof(header, proof)
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+
+		_, err = patricia.VerifyReceiptProof(&types.Header{ReceiptHash: common.Hash{}}, proof)
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("nil proof or header", func(t *testing.T) {
+		_, err := patricia.VerifyReceiptProof(header, nil)
+		require.ErrorIs(t, err, patricia.ErrInvalidProof)
+
+		proof, err := patricia.ProveReceipt(receipts, 0)
+		require.NoError(t, err)
+		_, err = patricia.VerifyReceiptProof(nil, proof)
+		require.ErrorIs(t, err, patricia.ErrInvalidProof)
+	})
+}
+
+func TestLogProof(t *testing.T) {
+	header := headerFromJSON(t, "testdata/16614538/header.json")
+	receipts := receiptsFromJSON(t, "testdata/16614538/receipts.json")
+
+	// receipt 6 is a legacy receipt, 63 an EIP-1559 one.
+	for _, pos := range [][2]int{{0, 0}, {6, 1}, {63, 0}, {63, 21}} {
+		proof, err := patricia.ProveLog(receipts, pos[0], pos[1])
+		require.NoError(t, err)
+		log, err := patricia.VerifyLogProof(header, proof)
+		require.NoError(t, err)
+
+		expected := receipts[pos[0]].Logs[pos[1]]
+		require.Equal(t, expected.Address, log.Address)
+		require.Equal(t, expected.Topics, log.Topics)
+		require.Equal(t, expected.Data, log.Data)
+		require.Equal(t, header.Number.Uint64(), log.BlockNumber)
+		require.Zero(t, log.BlockHash)
+		require.Equal(t, uint(pos[0]), log.TxIndex)
+	}
+
+	t.Run("receipt types", func(t *testing.T) {
+		log := &types.Log{
+			Address: common.HexToAddress("0x00000000219ab540356cbb839cbe05303d7705fa"),
+			Topics:  []common.Hash{common.HexToHash("0x649bbc62d0e31342afea4e5cd82d4049e7e1ee912fc0889aa790803be39038c5")},
+			Data:    []byte("deposit"),
+		}
+		var receipts types.Receipts
+		for _, typ := range []uint8{types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType} {
+			receipt := &types.Receipt{
+				Type:              typ,
+				Status:            types.ReceiptStatusSuccessful,
+				CumulativeGasUsed: uint64(21000 * (len(receipts) + 1)),
+				Logs:              []*types.Log{{Address: log.Address}, log},
+			}
+			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+			receipts = append(receipts, receipt)
+		}
+		header := &types.Header{ReceiptHash: types.DeriveSha(receipts, patricia.New())}
+		for i := range receipts {
+			proof, err := patricia.ProveLog(receipts, i, 1)
+			require.NoError(t, err)
+			proven, err := patricia.VerifyLogProof(header, proof)
+			require.NoError(t, err)
+			require.Equal(t, log.Address, proven.Address)
+			require.Equal(t, log.Topics, proven.Topics)
+			require.Equal(t, log.Data, proven.Data)
+		}
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		_, err := patricia.ProveLog(receipts, 63, 22)
+		require.ErrorIs(t, err, patricia.ErrIndexOutOfRange)
+		_, err = patricia.ProveLog(receipts, len(receipts), 0)
+		require.ErrorIs(t, err, patricia.ErrIndexOutOfRange)
+
+		// the receipt doesn't hold a log at the claimed position.
+		proof, err := patricia.ProveLog(receipts, 63, 21)
+		require.NoError(t, err)
+		proof.LogIndex = 22
+		_, err = patricia.VerifyLogProof(header, proof)
+		require.ErrorIs(t, err, patricia.ErrNotIncluded)
+	})
+
+	t.Run("nil proof or header", func(t *testing.T) {
+		_, err := patricia.VerifyLogProof(header, nil)
+		require.ErrorIs(t, err, patricia.ErrInvalidProof)
+		_, err = patricia.VerifyLogProof(header, &patricia.LogProof{LogIndex: 1})
+		require.ErrorIs(t, err, patricia.ErrInvalidProof)
+
+		proof, err := patricia.ProveLog(receipts, 63, 5)
+		require.NoError(t, err)
+		_, err = patricia.VerifyLogProof(nil, proof)
+		require.ErrorIs(t, err, patricia.ErrInvalidProof)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		proof, err := patricia.ProveLog(receipts, 63, 5)
+		require.NoError(t, err)
+		enc, err := json.Marshal(proof)
+		require.NoError(t, err)
+		decoded := new(patricia.LogProof)
+		require.NoError(t, json.Unmarshal(enc, decoded))
+		log, err := patricia.VerifyLogProof(header, decoded)
+		require.NoError(t, err)
+		require.Equal(t, receipts[63].Logs[5].Data, log.Data)
+	})
+}
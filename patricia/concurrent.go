@@ -0,0 +1,203 @@
+package patricia
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	gethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// concurrentMPT is an MPT that is safe for concurrent use.
+//
+// Readers work on an immutable snapshot of the trie and never block. Writers
+// are serialized: every write is applied to a copy of the current snapshot
+// (which is cheap, see mpt.Copy), whose root is computed before it replaces
+// the snapshot. Since the hashes of all nodes in a snapshot are cached by
+// then, readers never write to the nodes they share with each other or with
+// the writer.
+type concurrentMPT struct {
+	// current holds the current common.MPT snapshot.
+	current atomic.Value
+	// mu serializes writers.
+	mu sync.Mutex
+	// err is the first error Update ran into, see Err. It is guarded by mu.
+	err error
+}
+
+var _ common.MPT = &concurrentMPT{}
+
+// snapshotHolder wraps snapshots, so that they can be stored in an
+// atomic.Value regardless of their concrete type.
+type snapshotHolder struct {
+	trie common.MPT
+}
+
+// NewConcurrent wraps trie so that it can be used from multiple goroutines
+// at once. trie must not be used directly afterwards.
+// Readers (Get, Root, ProofFor etc.) see a consistent snapshot of the trie,
+// and never a partially applied write.
+func NewConcurrent(trie common.MPT) common.MPT {
+	c := &concurrentMPT{}
+	trie.Root()
+	c.current.Store(snapshotHolder{trie: trie})
+	return c
+}
+
+// snapshot returns the current snapshot of the trie.
+func (c *concurrentMPT) snapshot() common.MPT {
+	return c.current.Load().(snapshotHolder).trie
+}
+
+// write applies fn to a copy of the current snapshot, and replaces the
+// snapshot with it if fn succeeds.
+func (c *concurrentMPT) write(fn func(next common.MPT) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next := c.snapshot().Copy()
+	if err := fn(next); err != nil {
+		return err
+	}
+	// compute the hashes of all new nodes before readers can see them.
+	// A snapshot whose root can't be computed is never published.
+	if next.Root() == nil {
+		return next.Err()
+	}
+	c.current.Store(snapshotHolder{trie: next})
+	return nil
+}
+
+// Get implements MPT
+func (c *concurrentMPT) Get(key []byte) (value []byte, err error) {
+	return c.snapshot().Get(key)
+}
+
+// Put implements MPT
+func (c *concurrentMPT) Put(key, value []byte) error {
+	return c.write(func(next common.MPT) error {
+		return next.Put(key, value)
+	})
+}
+
+// Delete implements MPT
+func (c *concurrentMPT) Delete(key []byte) error {
+	return c.write(func(next common.MPT) error {
+		return next.Delete(key)
+	})
+}
+
+// Root implements MPT
+func (c *concurrentMPT) Root() []byte {
+	return c.snapshot().Root()
+}
+
+// ProofFor implements MPT
+func (c *concurrentMPT) ProofFor(key []byte) (ethdb.KeyValueReader, error) {
+	return c.snapshot().ProofFor(key)
+}
+
+// ProofForKeys implements MultiProver
+func (c *concurrentMPT) ProofForKeys(keys [][]byte) (ethdb.KeyValueReader, error) {
+	snapshot := c.snapshot()
+	p, ok := snapshot.(MultiProver)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T can't prove several keys", ErrUnsupported, snapshot)
+	}
+	return p.ProofForKeys(keys)
+}
+
+// ProveRange implements RangeProver
+func (c *concurrentMPT) ProveRange(first, last []byte) (keys, values [][]byte, proof ethdb.KeyValueReader, err error) {
+	snapshot := c.snapshot()
+	p, ok := snapshot.(RangeProver)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w: %T can't prove ranges", ErrUnsupported, snapshot)
+	}
+	return p.ProveRange(first, last)
+}
+
+// Copy implements MPT
+// The copy is safe for concurrent use as well.
+func (c *concurrentMPT) Copy() common.MPT {
+	return NewConcurrent(c.snapshot().Copy())
+}
+
+// StartRecording implements Recorder
+// It does nothing if the wrapped trie can't record.
+func (c *concurrentMPT) StartRecording() {
+	c.write(func(next common.MPT) error {
+		if r, ok := next.(Recorder); ok {
+			r.StartRecording()
+		}
+		return nil
+	})
+}
+
+// StopRecording implements Recorder
+// Readers that are still working on a snapshot that was taken before
+// StopRecording keep recording to the returned witness until they're done.
+// It returns nil if the wrapped trie can't record.
+func (c *concurrentMPT) StopRecording() (witness ethdb.KeyValueStore) {
+	c.write(func(next common.MPT) error {
+		if r, ok := next.(Recorder); ok {
+			witness = r.StopRecording()
+		}
+		return nil
+	})
+	return witness
+}
+
+// Commit implements Committer
+func (c *concurrentMPT) Commit() (root []byte, err error) {
+	err = c.write(func(next common.MPT) error {
+		root, err = commitTrie(next)
+		return err
+	})
+	return root, err
+}
+
+// Err implements MPT
+func (c *concurrentMPT) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.snapshot().Err()
+}
+
+// Reset implements types.TrieHasher
+func (c *concurrentMPT) Reset() {
+	c.write(func(next common.MPT) error {
+		next.Reset()
+		c.err = nil
+		return nil
+	})
+}
+
+// Update implements types.TrieHasher
+// Errors are recorded rather than returned, see Err.
+func (c *concurrentMPT) Update(key, value []byte) {
+	if err := c.Put(key, value); err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err == nil {
+			c.err = err
+		}
+	}
+}
+
+// Hash implements types.TrieHasher
+func (c *concurrentMPT) Hash() gethCommon.Hash {
+	return c.snapshot().Hash()
+}
+
+// backing implements backed
+// Iterators and the other package level helpers work on the snapshot that
+// is current when they're created.
+func (c *concurrentMPT) backing() *mpt {
+	m, _ := trieOf(c.snapshot())
+	return m
+}
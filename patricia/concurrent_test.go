@@ -0,0 +1,139 @@
+package patricia_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentMPT(t *testing.T) {
+	key := func(i int) []byte {
+		return crypto.Keccak256([]byte(fmt.Sprint(i)))[:4]
+	}
+
+	hammer := func(t *testing.T, trie common.MPT, commit bool) {
+		const (
+			writers = 4
+			readers = 8
+			ops     = 200
+		)
+		var wg sync.WaitGroup
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < ops; i++ {
+					k := key(w*ops + i)
+					assert.NoError(t, trie.Put(k, k))
+					if i%3 == 0 {
+						// overwrites replace nodes too.
+						assert.NoError(t, trie.Put(key(w*ops+i/2), key(w*ops+i/2)))
+					}
+					if i%5 == 4 {
+						assert.NoError(t, trie.Delete(key(w*ops+i-2)))
+						// prefixes of keys are never in the trie.
+						assert.NoError(t, trie.Delete(k[:2]))
+					}
+					if commit && i%50 == 0 {
+						_, err := trie.(patricia.Committer).Commit()
+						assert.NoError(t, err)
+					}
+				}
+			}(w)
+		}
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				for i := 0; i < ops; i++ {
+					k := key((r*ops + i) % (writers * ops))
+					// values are always the keys themselves.
+					if v, err := trie.Get(k); err == nil {
+						assert.Equal(t, k, v)
+					} else {
+						assert.ErrorIs(t, err, common.ErrKeyNotFound)
+					}
+
+					// a snapshot is consistent: its proofs verify against its root.
+					snapshot := trie.Copy()
+					root := snapshot.Root()
+					proof, err := snapshot.ProofFor(k)
+					assert.NoError(t, err)
+					v, err := patricia.VerifyProof(root, k, proof)
+					assert.NoError(t, err)
+					if v != nil {
+						assert.Equal(t, k, v)
+					}
+
+					if i%20 == 0 {
+						it := patricia.NewIterator(trie, nil)
+						for it.Next() {
+							assert.Equal(t, it.Key(), it.Value())
+						}
+						assert.NoError(t, it.Err())
+					}
+				}
+			}(r)
+		}
+		wg.Wait()
+
+		// the end result is the same as applying the writes sequentially,
+		// since every writer touches its own keys only.
+		expected := patricia.New()
+		for w := 0; w < writers; w++ {
+			for i := 0; i < ops; i++ {
+				require.NoError(t, expected.Put(key(w*ops+i), key(w*ops+i)))
+				if i%3 == 0 {
+					require.NoError(t, expected.Put(key(w*ops+i/2), key(w*ops+i/2)))
+				}
+				if i%5 == 4 {
+					require.NoError(t, expected.Delete(key(w*ops+i-2)))
+				}
+			}
+		}
+		require.Equal(t, expected.Root(), trie.Root())
+	}
+
+	t.Run("in memory", func(t *testing.T) {
+		hammer(t, patricia.NewConcurrent(patricia.New()), false)
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		inner, err := patricia.Open(nil, rawdb.NewMemoryDatabase())
+		require.NoError(t, err)
+		hammer(t, patricia.NewConcurrent(inner), true)
+	})
+
+	t.Run("parallel hashing", func(t *testing.T) {
+		hammer(t, patricia.NewConcurrent(patricia.New(patricia.WithParallelHashing(0, 4))), false)
+	})
+
+	t.Run("secure", func(t *testing.T) {
+		trie := patricia.NewConcurrent(patricia.NewSecure(patricia.New(), rawdb.NewMemoryDatabase()))
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					assert.NoError(t, trie.Put(key(w*100+i), []byte{1}))
+					_, err := trie.Get(key(w * 100))
+					assert.NoError(t, err)
+				}
+			}(w)
+		}
+		wg.Wait()
+		expected := patricia.NewSecure(patricia.New(), nil)
+		for i := 0; i < 400; i++ {
+			require.NoError(t, expected.Put(key(i), []byte{1}))
+		}
+		require.Equal(t, expected.Root(), trie.Root())
+	})
+}
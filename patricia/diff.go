@@ -0,0 +1,159 @@
+package patricia
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+)
+
+// Change is a difference between two versions of a trie.
+type Change struct {
+	Key []byte
+	// Old is the value in the first trie, nil if the key was added.
+	Old []byte
+	// New is the value in the second trie, nil if the key was removed.
+	New []byte
+}
+
+// Diff calls fn for every key whose value differs between a and b, in
+// ascending order of the keys. Both tries are walked at once, and subtrees
+// with the same hash on both sides are skipped without being loaded, so the
+// cost of a diff is proportional to the size of the change rather than the
+// size of the tries.
+// If fn returns an error, Diff stops and returns it.
+func Diff(a, b common.MPT, fn func(c Change) error) error {
+	ma, err := trieOf(a)
+	if err != nil {
+		return err
+	}
+	mb, err := trieOf(b)
+	if err != nil {
+		return err
+	}
+	d := &differ{a: ma, b: mb, fn: fn}
+	return d.diff(ma.root, mb.root, nil)
+}
+
+type differ struct {
+	a, b *mpt
+	fn   func(c Change) error
+}
+
+// diff compares the subtrees rooted at an and bn, which are both found at
+// path (in nibbles).
+func (d *differ) diff(an, bn mptNode, path []byte) error {
+	if an == nil && bn == nil {
+		return nil
+	}
+	if an != nil && bn != nil {
+		ah, err := hash(an)
+		if err != nil {
+			return err
+		}
+		bh, err := hash(bn)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(ah, bh) {
+			return nil
+		}
+	}
+
+	an, err := d.a.load(an)
+	if err != nil {
+		return err
+	}
+	bn, err = d.b.load(bn)
+	if err != nil {
+		return err
+	}
+	if an == nil {
+		return walk(d.b, bn, path, func(key, value []byte) error {
+			return d.fn(Change{Key: key, New: value})
+		})
+	}
+	if bn == nil {
+		return walk(d.a, an, path, func(key, value []byte) error {
+			return d.fn(Change{Key: key, Old: value})
+		})
+	}
+
+	// the nodes may be of different kinds, or extensions with different
+	// paths, so both are compared one nibble at a time as branches.
+	aValue, aChildren, err := asBranch(an)
+	if err != nil {
+		return err
+	}
+	bValue, bChildren, err := asBranch(bn)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(aValue, bValue) {
+		err := d.fn(Change{Key: common.NibblesToBytes(path), Old: aValue, New: bValue})
+		if err != nil {
+			return err
+		}
+	}
+	for i := range aChildren {
+		if err := d.diff(aChildren[i], bChildren[i], common.Concat(path, []byte{byte(i)})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// asBranch returns the value and children n would have if it were a branch.
+// Leaves and extensions have a single child, the node itself without the
+// first nibble of its path.
+func asBranch(n mptNode) (value []byte, children [16]mptNode, err error) {
+	switch n := n.(type) {
+	case *branchNode:
+		return n.value, n.children, nil
+	case *extensionNode:
+		if len(n.path) == 0 {
+			return nil, children, fmt.Errorf("%w: extension with an empty path", ErrInvariant)
+		}
+		if len(n.path) == 1 {
+			children[n.path[0]] = n.next
+		} else {
+			children[n.path[0]] = &extensionNode{path: n.path[1:], next: n.next}
+		}
+	case *leafNode:
+		if len(n.path) == 0 {
+			return n.value, children, nil
+		}
+		children[n.path[0]] = &leafNode{path: n.path[1:], value: n.value}
+	}
+	return nil, children, nil
+}
+
+// walk calls fn for every key-value pair in the subtree rooted at n, which is
+// found at path (in nibbles), in ascending order of the keys.
+func walk(m *mpt, n mptNode, path []byte, fn func(key, value []byte) error) error {
+	n, err := m.load(n)
+	if err != nil {
+		return err
+	}
+	switch n := n.(type) {
+	case *leafNode:
+		return fn(common.NibblesToBytes(common.Concat(path, n.path)), n.value)
+	case *extensionNode:
+		return walk(m, n.next, common.Concat(path, n.path), fn)
+	case *branchNode:
+		if n.value != nil {
+			if err := fn(common.NibblesToBytes(path), n.value); err != nil {
+				return err
+			}
+		}
+		for i, c := range n.children {
+			if c == nil {
+				continue
+			}
+			if err := walk(m, c, common.Concat(path, []byte{byte(i)}), fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
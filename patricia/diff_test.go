@@ -0,0 +1,132 @@
+package patricia_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDB counts the nodes read from the database.
+type countingDB struct {
+	ethdb.KeyValueStore
+	reads int
+}
+
+func (c *countingDB) Get(key []byte) ([]byte, error) {
+	c.reads++
+	return c.KeyValueStore.Get(key)
+}
+
+func collectChanges(t *testing.T, a, b common.MPT) []patricia.Change {
+	var changes []patricia.Change
+	require.NoError(t, patricia.Diff(a, b, func(c patricia.Change) error {
+		changes = append(changes, c)
+		return nil
+	}))
+	return changes
+}
+
+func TestDiff(t *testing.T) {
+	t.Run("identical tries", func(t *testing.T) {
+		a := patricia.New()
+		require.NoError(t, a.Put([]byte("key"), []byte("value")))
+		require.Empty(t, collectChanges(t, a, a.Copy()))
+		require.Empty(t, collectChanges(t, patricia.New(), patricia.New()))
+	})
+
+	t.Run("added, changed and removed keys", func(t *testing.T) {
+		a := patricia.New()
+		key := func(i int) []byte {
+			return crypto.Keccak256([]byte{byte(i)})[:3]
+		}
+		for i := 0; i < 200; i++ {
+			require.NoError(t, a.Put(key(i), []byte(fmt.Sprintf("value-%d", i))))
+		}
+		// short keys, whose values end up in branches.
+		for i := 0; i < 10; i++ {
+			require.NoError(t, a.Put(key(i)[:1], []byte("short")))
+		}
+		b := a.Copy()
+		expected := map[string]patricia.Change{}
+		require.NoError(t, b.Put(key(0)[:1], []byte("changed")))
+		expected[string(key(0)[:1])] = patricia.Change{Key: key(0)[:1], Old: []byte("short"), New: []byte("changed")}
+		require.NoError(t, b.Put(key(0)[:2], []byte("added")))
+		expected[string(key(0)[:2])] = patricia.Change{Key: key(0)[:2], New: []byte("added")}
+		require.NoError(t, b.Delete(key(1)[:1]))
+		expected[string(key(1)[:1])] = patricia.Change{Key: key(1)[:1], Old: []byte("short")}
+		for i := 0; i < 200; i += 7 {
+			old, err := b.Get(key(i))
+			require.NoError(t, err)
+			require.NoError(t, b.Delete(key(i)))
+			expected[string(key(i))] = patricia.Change{Key: key(i), Old: old}
+		}
+		for i := 3; i < 200; i += 11 {
+			if _, ok := expected[string(key(i))]; ok {
+				continue
+			}
+			old, err := b.Get(key(i))
+			require.NoError(t, err)
+			require.NoError(t, b.Put(key(i), []byte("changed")))
+			expected[string(key(i))] = patricia.Change{Key: key(i), Old: old, New: []byte("changed")}
+		}
+		for i := 0; i < 30; i++ {
+			k := []byte(fmt.Sprintf("new-%d", i))
+			require.NoError(t, b.Put(k, []byte("added")))
+			expected[string(k)] = patricia.Change{Key: k, New: []byte("added")}
+		}
+
+		changes := collectChanges(t, a, b)
+		require.Len(t, changes, len(expected))
+		for i, c := range changes {
+			require.Equal(t, expected[string(c.Key)], c)
+			if i > 0 {
+				require.Negative(t, bytes.Compare(changes[i-1].Key, c.Key), "changes out of order")
+			}
+		}
+
+		// diffing the other way around swaps old and new values.
+		for i, c := range collectChanges(t, b, a) {
+			require.Equal(t, changes[i], patricia.Change{Key: c.Key, Old: c.New, New: c.Old})
+		}
+	})
+
+	t.Run("unchanged subtrees aren't loaded", func(t *testing.T) {
+		db := &countingDB{KeyValueStore: rawdb.NewMemoryDatabase()}
+		a, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, a.Put(crypto.Keccak256([]byte(fmt.Sprint(i))), []byte{byte(i)}))
+		}
+		root, err := a.(patricia.Committer).Commit()
+		require.NoError(t, err)
+
+		a, err = patricia.Open(root, db)
+		require.NoError(t, err)
+		b := a.Copy()
+		changedKey := crypto.Keccak256([]byte("42"))
+		require.NoError(t, b.Put(changedKey, []byte("changed")))
+
+		db.reads = 0
+		changes := collectChanges(t, a, b)
+		require.Equal(t, []patricia.Change{{Key: changedKey, Old: []byte{42}, New: []byte("changed")}}, changes)
+		// only the nodes on the path of the changed key are loaded.
+		require.Less(t, db.reads, 10)
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		a := patricia.New()
+		require.NoError(t, a.Put([]byte("key"), []byte("value")))
+		errStop := fmt.Errorf("stop")
+		err := patricia.Diff(patricia.New(), a, func(c patricia.Change) error {
+			return errStop
+		})
+		require.ErrorIs(t, err, errStop)
+	})
+}
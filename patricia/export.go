@@ -0,0 +1,202 @@
+package patricia
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// WriteASCII writes the structure of t to w as an indented tree, e.g:
+//
+//	branch path=[] hash=0x63dc660f…
+//	|-- 1: extension path=[1] nibbles=[2] compact=0x12 hash=0xb6fec1d8…
+//	|   `-- [2]: branch path=[1 2] value=0x612076616c756520… (37 bytes) hash=0x8d3dcf28…
+//	|       |-- 3: leaf path=[1 2 3] nibbles=[4] compact=0x34 value=0x61 (1 bytes) inline
+//	|       `-- 5: leaf path=[1 2 5] nibbles=[6] compact=0x36 value=0x62 (1 bytes) inline
+//	`-- 4: leaf path=[4] nibbles=[0] compact=0x30 value=0x63 (1 bytes) inline
+//
+// Every node shows its kind, its path from the root in nibbles and whether it
+// is embedded in its parent or referenced by hash. Leaves and extensions also
+// show their own nibbles and their compact encoding, leaves and branches
+// their value. Subtrees that aren't available, e.g in a trie built by
+// FromProof, are shown as missing.
+func WriteASCII(w io.Writer, t common.MPT) error {
+	root, err := exportTree(t)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	writeASCII(&b, root, "", "")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func writeASCII(b *strings.Builder, n *exportNode, first, rest string) {
+	b.WriteString(first)
+	if n.edge != "" {
+		b.WriteString(n.edge + ": ")
+	}
+	b.WriteString(strings.Join(n.label, " "))
+	b.WriteString("\n")
+	for i, c := range n.children {
+		if i == len(n.children)-1 {
+			writeASCII(b, c, rest+"`-- ", rest+"    ")
+		} else {
+			writeASCII(b, c, rest+"|-- ", rest+"|   ")
+		}
+	}
+}
+
+// WriteDOT writes the structure of t to w as a Graphviz DOT graph, with the
+// same details as WriteASCII. Edges are labeled with the nibble they stand
+// for, the edge from an extension to its child is labeled with the
+// extension's nibbles.
+func WriteDOT(w io.Writer, t common.MPT) error {
+	root, err := exportTree(t)
+	if err != nil {
+		return err
+	}
+	var (
+		b  strings.Builder
+		id int
+	)
+	b.WriteString("digraph trie {\n")
+	b.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	var write func(n *exportNode) int
+	write = func(n *exportNode) int {
+		self := id
+		id++
+		fmt.Fprintf(&b, "\tn%d [label=%q];\n", self, strings.Join(n.label, "\n"))
+		for _, c := range n.children {
+			child := write(c)
+			fmt.Fprintf(&b, "\tn%d -> n%d [label=%q];\n", self, child, c.edge)
+		}
+		return self
+	}
+	write(root)
+	b.WriteString("}\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// exportNode is a node as it is shown by the exporters.
+type exportNode struct {
+	// edge is the label of the edge from the parent.
+	edge     string
+	label    []string
+	children []*exportNode
+}
+
+func exportTree(t common.MPT) (*exportNode, error) {
+	m, err := trieOf(t)
+	if err != nil {
+		return nil, err
+	}
+	if m.root == nil {
+		return &exportNode{label: []string{"empty"}}, nil
+	}
+	return exportSubtree(m, m.root, nil, "", true)
+}
+
+// exportSubtree converts the subtree referenced by ref, whose path from the
+// root is path, into exportNodes.
+func exportSubtree(m *mpt, ref mptNode, path []byte, edge string, isRoot bool) (*exportNode, error) {
+	n, err := m.load(ref)
+	if errors.Is(err, ErrMissingNode) {
+		return &exportNode{
+			edge:  edge,
+			label: []string{"missing", "path=" + nibbleString(path), fmt.Sprintf("hash=%s", shortHex(ref.(hashNode)))},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &exportNode{edge: edge}
+	switch n := n.(type) {
+	case *leafNode:
+		compact, err := common.CompactEncode(n.path, true)
+		if err != nil {
+			return nil, err
+		}
+		e.label = []string{
+			"leaf",
+			"path=" + nibbleString(path),
+			"nibbles=" + nibbleString(n.path),
+			fmt.Sprintf("compact=%#x", compact),
+			"value=" + valuePreview(n.value),
+		}
+	case *extensionNode:
+		compact, err := common.CompactEncode(n.path, false)
+		if err != nil {
+			return nil, err
+		}
+		e.label = []string{
+			"extension",
+			"path=" + nibbleString(path),
+			"nibbles=" + nibbleString(n.path),
+			fmt.Sprintf("compact=%#x", compact),
+		}
+		child, err := exportSubtree(m, n.next, common.Concat(path, n.path), nibbleString(n.path), false)
+		if err != nil {
+			return nil, err
+		}
+		e.children = append(e.children, child)
+	case *branchNode:
+		e.label = []string{"branch", "path=" + nibbleString(path)}
+		if n.value != nil {
+			e.label = append(e.label, "value="+valuePreview(n.value))
+		}
+		for i, c := range n.children {
+			if c == nil {
+				continue
+			}
+			child, err := exportSubtree(m, c, common.Concat(path, []byte{byte(i)}), fmt.Sprintf("%x", i), false)
+			if err != nil {
+				return nil, err
+			}
+			e.children = append(e.children, child)
+		}
+	}
+
+	enc, err := serialize(n)
+	if err != nil {
+		return nil, err
+	}
+	// the root is always referenced by hash.
+	if _, ok := ref.(hashNode); ok || isRoot || len(enc) >= 32 {
+		e.label = append(e.label, "hash="+shortHex(crypto.Keccak256(enc)))
+	} else {
+		e.label = append(e.label, "inline")
+	}
+	return e, nil
+}
+
+// nibbleString formats nibbles as e.g [a 0 3].
+func nibbleString(nibbles []byte) string {
+	s := make([]string, len(nibbles))
+	for i, n := range nibbles {
+		s[i] = fmt.Sprintf("%x", n)
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+// shortHex formats the first 4 bytes of a hash.
+func shortHex(h []byte) string {
+	if len(h) <= 4 {
+		return fmt.Sprintf("%#x", h)
+	}
+	return fmt.Sprintf("%#x…", h[:4])
+}
+
+// valuePreview formats the first 8 bytes of a value along with its size.
+func valuePreview(v []byte) string {
+	if len(v) <= 8 {
+		return fmt.Sprintf("%#x (%d bytes)", v, len(v))
+	}
+	return fmt.Sprintf("%#x… (%d bytes)", v[:8], len(v))
+}
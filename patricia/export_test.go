@@ -0,0 +1,70 @@
+package patricia_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func exampleTrie(t *testing.T) common.MPT {
+	trie := patricia.New()
+	require.NoError(t, trie.Put([]byte{0x12, 0x34}, []byte("a")))
+	require.NoError(t, trie.Put([]byte{0x12, 0x56}, []byte("b")))
+	require.NoError(t, trie.Put([]byte{0x12}, []byte("a value that doesn't fit in a preview")))
+	require.NoError(t, trie.Put([]byte{0x40}, []byte("c")))
+	return trie
+}
+
+func TestWriteASCII(t *testing.T) {
+	t.Run("example trie", func(t *testing.T) {
+		var b strings.Builder
+		require.NoError(t, patricia.WriteASCII(&b, exampleTrie(t)))
+		require.Equal(t, `branch path=[] hash=0x63dc660f…
+|-- 1: extension path=[1] nibbles=[2] compact=0x12 hash=0xb6fec1d8…
+|   `+"`"+`-- [2]: branch path=[1 2] value=0x612076616c756520… (37 bytes) hash=0x8d3dcf28…
+|       |-- 3: leaf path=[1 2 3] nibbles=[4] compact=0x34 value=0x61 (1 bytes) inline
+|       `+"`"+`-- 5: leaf path=[1 2 5] nibbles=[6] compact=0x36 value=0x62 (1 bytes) inline
+`+"`"+`-- 4: leaf path=[4] nibbles=[0] compact=0x30 value=0x63 (1 bytes) inline
+`, b.String())
+	})
+
+	t.Run("empty trie", func(t *testing.T) {
+		var b strings.Builder
+		require.NoError(t, patricia.WriteASCII(&b, patricia.New()))
+		require.Equal(t, "empty\n", b.String())
+	})
+
+	t.Run("partial trie", func(t *testing.T) {
+		full := patricia.New()
+		for i := 0; i < 20; i++ {
+			key := crypto.Keccak256([]byte{byte(i)})
+			require.NoError(t, full.Put(key, key))
+		}
+		key := crypto.Keccak256([]byte{0})
+		proof, err := full.ProofFor(key)
+		require.NoError(t, err)
+		partial, err := patricia.FromProof(full.Root(), proof)
+		require.NoError(t, err)
+		var b strings.Builder
+		require.NoError(t, patricia.WriteASCII(&b, partial))
+		require.Contains(t, b.String(), "missing path=")
+		require.Contains(t, b.String(), "leaf path=")
+	})
+}
+
+func TestWriteDOT(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, patricia.WriteDOT(&b, exampleTrie(t)))
+	dot := b.String()
+	require.True(t, strings.HasPrefix(dot, "digraph trie {\n"))
+	require.True(t, strings.HasSuffix(dot, "}\n"))
+	require.Contains(t, dot, `n0 [label="branch\npath=[]\nhash=0x63dc660f…"];`)
+	require.Contains(t, dot, `n2 [label="branch\npath=[1 2]\nvalue=0x612076616c756520… (37 bytes)\nhash=0x8d3dcf28…"];`)
+	require.Contains(t, dot, `n1 -> n2 [label="[2]"];`)
+	require.Contains(t, dot, `n0 -> n5 [label="4"];`)
+	require.Equal(t, 5, strings.Count(dot, "->"))
+}
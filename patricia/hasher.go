@@ -0,0 +1,76 @@
+package patricia
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Option configures a trie created by New or Open.
+type Option func(m *mpt)
+
+// WithParallelHashing makes the trie hash the children of its top-level
+// branch concurrently, on at most concurrency goroutines, whenever at least
+// threshold keys were changed since the root was last computed. Smaller
+// changes don't benefit from it, since only the nodes on the changed paths
+// have to be hashed again.
+// If concurrency isn't positive, runtime.NumCPU() goroutines are used.
+func WithParallelHashing(threshold, concurrency int) Option {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	return func(m *mpt) {
+		m.hasher = hasherConfig{
+			parallel:    true,
+			threshold:   threshold,
+			concurrency: concurrency,
+		}
+	}
+}
+
+// hasherConfig configures how the root of a trie is computed.
+type hasherConfig struct {
+	parallel    bool
+	threshold   int
+	concurrency int
+}
+
+// hashChildren computes the hashes of the children of the top-level branch
+// of m concurrently, so that computing the root from there on only takes the
+// cached hashes.
+// Every subtree is hashed by a single goroutine, and the subtrees of a trie
+// don't share any nodes with each other. Copies of m may share nodes with m,
+// but mpt.Copy computes their hashes first, and caches of hashed nodes are
+// never written again, so hashChildren only writes to nodes that m alone
+// holds.
+func (m *mpt) hashChildren() {
+	node := m.root
+	if e, ok := node.(*extensionNode); ok {
+		node = e.next
+	}
+	branch, ok := node.(*branchNode)
+	if !ok || branch.flags.enc != nil {
+		return
+	}
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, m.hasher.concurrency)
+	)
+	for _, c := range branch.children {
+		switch c.(type) {
+		case nil, hashNode:
+			continue
+		}
+		if c.cache().enc != nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c mptNode) {
+			defer wg.Done()
+			ref(c)
+			<-sem
+		}(c)
+	}
+	wg.Wait()
+}
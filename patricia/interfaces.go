@@ -0,0 +1,77 @@
+package patricia
+
+import (
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+var (
+	// ErrUnsupported is returned when a wrapper, e.g NewSecure, is asked
+	// for something the trie it wraps can't do.
+	ErrUnsupported = fmt.Errorf("operation not supported by trie")
+)
+
+// The tries of this package implement the following interfaces on top of
+// common.MPT. Since the constructors return a common.MPT, they're used with
+// a type assertion, e.g trie.(patricia.Committer).Commit().
+
+// Committer is a trie whose nodes can be written to a database, see Open.
+type Committer interface {
+	// Commit persists all changes made to the trie to its backing database
+	// and returns the new root.
+	Commit() (root []byte, err error)
+}
+
+// MultiProver is a trie that can prove several keys at once.
+type MultiProver interface {
+	// ProofForKeys returns a single proof for all of the given keys.
+	ProofForKeys(keys [][]byte) (proofDB ethdb.KeyValueReader, err error)
+}
+
+// RangeProver is a trie that can prove a range of keys, see
+// VerifyRangeProof.
+type RangeProver interface {
+	// ProveRange returns all key-value pairs with keys in [first, last]
+	// along with a proof that there are no others.
+	ProveRange(first, last []byte) (keys, values [][]byte, proof ethdb.KeyValueReader, err error)
+}
+
+// Recorder is a trie that can record the nodes its operations touch, see
+// FromProof.
+type Recorder interface {
+	// StartRecording starts recording all nodes touched by the following
+	// operations on the trie.
+	StartRecording()
+	// StopRecording stops recording and returns the recorded nodes, which
+	// are enough to replay the same operations on the trie as it was when
+	// recording started.
+	StopRecording() (witness ethdb.KeyValueStore)
+}
+
+// commitTrie commits t if it is a Committer.
+func commitTrie(t common.MPT) (root []byte, err error) {
+	c, ok := t.(Committer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T can't be committed", ErrUnsupported, t)
+	}
+	return c.Commit()
+}
+
+var (
+	_ Committer   = &mpt{}
+	_ MultiProver = &mpt{}
+	_ RangeProver = &mpt{}
+	_ Recorder    = &mpt{}
+
+	_ Committer   = &secureMPT{}
+	_ MultiProver = &secureMPT{}
+	_ RangeProver = &secureMPT{}
+	_ Recorder    = &secureMPT{}
+
+	_ Committer   = &concurrentMPT{}
+	_ MultiProver = &concurrentMPT{}
+	_ RangeProver = &concurrentMPT{}
+	_ Recorder    = &concurrentMPT{}
+)
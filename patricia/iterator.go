@@ -0,0 +1,281 @@
+package patricia
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrUnsupportedTrie is returned by the package level helpers when
+	// they are given a common.MPT that isn't implemented by this package.
+	ErrUnsupportedTrie = fmt.Errorf("trie not implemented by package patricia")
+)
+
+// backed is implemented by all tries in this package. It gives the
+// package level helpers (iterators etc.) access to the underlying nodes.
+type backed interface {
+	backing() *mpt
+}
+
+// backing implements backed
+func (m *mpt) backing() *mpt {
+	return m
+}
+
+// trieOf returns the mpt that backs t.
+func trieOf(t common.MPT) (*mpt, error) {
+	if b, ok := t.(backed); ok {
+		if m := b.backing(); m != nil {
+			return m, nil
+		}
+	}
+	return nil, ErrUnsupportedTrie
+}
+
+// NodeType is the kind of a node in the trie.
+type NodeType int
+
+const (
+	NodeTypeBranch NodeType = iota
+	NodeTypeExtension
+	NodeTypeLeaf
+)
+
+// String returns the name of the node type.
+func (t NodeType) String() string {
+	switch t {
+	case NodeTypeBranch:
+		return "branch"
+	case NodeTypeExtension:
+		return "extension"
+	case NodeTypeLeaf:
+		return "leaf"
+	default:
+		return fmt.Sprintf("NodeType(%d)", int(t))
+	}
+}
+
+// NodeIterator walks the nodes of a trie depth-first, visiting a node
+// before its children and the children of a branch in ascending order
+// of their nibble. Keys are therefore encountered in lexicographic order.
+// Nodes that are only referenced by hash are loaded as they are reached.
+type NodeIterator struct {
+	m *mpt
+	// subtrees that only hold keys before start or keys that don't have
+	// the given prefix are skipped. Both are in nibbles.
+	start, prefix []byte
+	stack         []nodeIteratorItem
+
+	current nodeIteratorItem
+	node    mptNode
+	err     error
+}
+
+// nodeIteratorItem is a node that's yet to be visited, along with
+// its path from the root.
+type nodeIteratorItem struct {
+	path []byte
+	// ref is the node as referenced by its parent, i.e possibly a hashNode.
+	ref    mptNode
+	isRoot bool
+}
+
+// NewNodeIterator returns an iterator over the nodes of t, skipping
+// subtrees whose keys all sort before start.
+func NewNodeIterator(t common.MPT, start []byte) *NodeIterator {
+	m, err := trieOf(t)
+	if err != nil {
+		return &NodeIterator{err: err}
+	}
+	return newNodeIterator(m, common.BytesToNibbles(start), nil)
+}
+
+func newNodeIterator(m *mpt, start, prefix []byte) *NodeIterator {
+	it := &NodeIterator{
+		m:      m,
+		prefix: prefix,
+	}
+	it.seek(start)
+	return it
+}
+
+// seek restarts the iteration from the root, skipping everything before
+// the given nibbles.
+func (it *NodeIterator) seek(start []byte) {
+	it.start = start
+	it.stack = it.stack[:0]
+	it.node = nil
+	if it.m.root != nil {
+		it.stack = append(it.stack, nodeIteratorItem{ref: it.m.root, isRoot: true})
+	}
+}
+
+// Next advances the iterator to the next node, and reports whether
+// there is one.
+func (it *NodeIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.stack) == 0 {
+		it.node = nil
+		return false
+	}
+
+	item := it.stack[len(it.stack)-1]
+	it.stack = it.stack[:len(it.stack)-1]
+	node, err := it.m.load(item.ref)
+	if err != nil {
+		it.err = err
+		it.node = nil
+		return false
+	}
+	it.current, it.node = item, node
+
+	// push children in reverse, so that they're popped in order.
+	switch n := node.(type) {
+	case *extensionNode:
+		it.push(common.Concat(item.path, n.path), n.next)
+	case *branchNode:
+		for i := len(n.children) - 1; i >= 0; i-- {
+			if n.children[i] != nil {
+				it.push(common.Concat(item.path, []byte{byte(i)}), n.children[i])
+			}
+		}
+	}
+	return true
+}
+
+func (it *NodeIterator) push(path []byte, ref mptNode) {
+	// all keys in the subtree sort before start
+	if bytes.Compare(path, it.start) < 0 && !common.HasPrefix(it.start, path) {
+		return
+	}
+	// keys in the subtree can't have the prefix
+	if !common.HasPrefix(path, it.prefix) && !common.HasPrefix(it.prefix, path) {
+		return
+	}
+	it.stack = append(it.stack, nodeIteratorItem{path: path, ref: ref})
+}
+
+// Path returns the path of the current node from the root, in nibbles.
+func (it *NodeIterator) Path() []byte {
+	return it.current.path
+}
+
+// Type returns the kind of the current node.
+func (it *NodeIterator) Type() NodeType {
+	switch it.node.(type) {
+	case *extensionNode:
+		return NodeTypeExtension
+	case *leafNode:
+		return NodeTypeLeaf
+	default:
+		return NodeTypeBranch
+	}
+}
+
+// Hash returns the hash the current node is referenced by. It returns nil
+// for nodes that are small enough to be embedded in their parent, and for
+// nodes that can't be encoded (see Validate).
+func (it *NodeIterator) Hash() []byte {
+	if h, ok := it.current.ref.(hashNode); ok {
+		return h
+	}
+	enc, err := serialize(it.node)
+	if err != nil {
+		return nil
+	}
+	if it.current.isRoot || len(enc) >= 32 {
+		return crypto.Keccak256(enc)
+	}
+	return nil
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *NodeIterator) Err() error {
+	return it.err
+}
+
+// Iterator iterates over the key-value pairs of a trie in lexicographic
+// order of their keys.
+type Iterator struct {
+	nodes      *NodeIterator
+	key, value []byte
+}
+
+// NewIterator returns an iterator over the key-value pairs of t whose keys
+// are greater than or equal to start.
+func NewIterator(t common.MPT, start []byte) *Iterator {
+	return &Iterator{
+		nodes: NewNodeIterator(t, start),
+	}
+}
+
+// NewPrefixIterator returns an iterator over the key-value pairs of t whose
+// keys start with prefix.
+func NewPrefixIterator(t common.MPT, prefix []byte) *Iterator {
+	m, err := trieOf(t)
+	if err != nil {
+		return &Iterator{nodes: &NodeIterator{err: err}}
+	}
+	nibbles := common.BytesToNibbles(prefix)
+	return &Iterator{
+		nodes: newNodeIterator(m, nibbles, nibbles),
+	}
+}
+
+// Next advances the iterator to the next key-value pair, and reports
+// whether there is one.
+func (it *Iterator) Next() bool {
+	for it.nodes.Next() {
+		var key, value []byte
+		switch n := it.nodes.node.(type) {
+		case *leafNode:
+			key, value = common.Concat(it.nodes.Path(), n.path), n.value
+		case *branchNode:
+			if n.value == nil {
+				continue
+			}
+			key, value = it.nodes.Path(), n.value
+		default:
+			continue
+		}
+		// the node iterator only skips whole subtrees, so leaves and
+		// branch values are checked individually.
+		if bytes.Compare(key, it.nodes.start) < 0 || !common.HasPrefix(key, it.nodes.prefix) {
+			continue
+		}
+		it.key, it.value = common.NibblesToBytes(key), value
+		return true
+	}
+	it.key, it.value = nil, nil
+	return false
+}
+
+// Seek moves the iterator so that the next call to Next returns the first
+// key-value pair whose key is greater than or equal to start.
+func (it *Iterator) Seek(start []byte) {
+	if it.nodes.m == nil {
+		return
+	}
+	it.nodes.seek(common.BytesToNibbles(start))
+	it.key, it.value = nil, nil
+}
+
+// Key returns the key of the current key-value pair.
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the value of the current key-value pair.
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.nodes.Err()
+}
@@ -0,0 +1,143 @@
+package patricia_test
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterator(t *testing.T) {
+	t.Run("empty trie", func(t *testing.T) {
+		it := patricia.NewIterator(patricia.New(), nil)
+		assert.False(t, it.Next())
+		assert.NoError(t, it.Err())
+	})
+
+	trie := patricia.New()
+	var keys [][]byte
+	for i := 0; i < 300; i++ {
+		key := crypto.Keccak256([]byte{byte(i), byte(i >> 8)})[:1+i%8]
+		if v, _ := trie.Get(key); v != nil {
+			continue
+		}
+		require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value-%x", key))))
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	collect := func(t *testing.T, it *patricia.Iterator) (r [][]byte) {
+		for it.Next() {
+			assert.Equal(t, []byte(fmt.Sprintf("value-%x", it.Key())), it.Value())
+			r = append(r, it.Key())
+		}
+		require.NoError(t, it.Err())
+		return
+	}
+
+	t.Run("all keys in order", func(t *testing.T) {
+		assert.Equal(t, keys, collect(t, patricia.NewIterator(trie, nil)))
+	})
+
+	t.Run("start", func(t *testing.T) {
+		assert.Equal(t, keys[100:], collect(t, patricia.NewIterator(trie, keys[100])))
+		// an absent start key begins at the next key.
+		assert.Equal(t, keys[101:], collect(t, patricia.NewIterator(trie, append(keys[100], 0))))
+		assert.Empty(t, collect(t, patricia.NewIterator(trie, bytes.Repeat([]byte{0xff}, 9))))
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		it := patricia.NewIterator(trie, nil)
+		require.True(t, it.Next())
+		require.True(t, it.Next())
+		it.Seek(keys[250])
+		assert.Equal(t, keys[250:], collect(t, it))
+		it.Seek(keys[10])
+		assert.Equal(t, keys[10:], collect(t, it))
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		prefix := keys[42][:1]
+		var expected [][]byte
+		for _, key := range keys {
+			if bytes.HasPrefix(key, prefix) {
+				expected = append(expected, key)
+			}
+		}
+		assert.Equal(t, expected, collect(t, patricia.NewPrefixIterator(trie, prefix)))
+		assert.Equal(t, [][]byte{keys[42]}, collect(t, patricia.NewPrefixIterator(trie, keys[42]))[:1])
+	})
+
+	t.Run("variable length keys", func(t *testing.T) {
+		trie := patricia.New()
+		for _, key := range []string{"do", "dog", "doge", "horse", "dot", "d"} {
+			require.NoError(t, trie.Put([]byte(key), []byte(fmt.Sprintf("value-%x", key))))
+		}
+		var r []string
+		for _, key := range collect(t, patricia.NewIterator(trie, nil)) {
+			r = append(r, string(key))
+		}
+		assert.Equal(t, []string{"d", "do", "dog", "doge", "dot", "horse"}, r)
+
+		r = nil
+		for _, key := range collect(t, patricia.NewPrefixIterator(trie, []byte("dog"))) {
+			r = append(r, string(key))
+		}
+		assert.Equal(t, []string{"dog", "doge"}, r)
+	})
+
+	t.Run("persisted trie", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		persisted, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for _, key := range keys {
+			require.NoError(t, persisted.Put(key, []byte(fmt.Sprintf("value-%x", key))))
+		}
+		root, err := persisted.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		reopened, err := patricia.Open(root, db)
+		require.NoError(t, err)
+		assert.Equal(t, keys, collect(t, patricia.NewIterator(reopened, nil)))
+
+		// missing nodes stop the iteration.
+		require.NoError(t, db.Delete(root))
+		it := patricia.NewIterator(reopened, nil)
+		assert.False(t, it.Next())
+		assert.ErrorIs(t, it.Err(), patricia.ErrMissingNode)
+	})
+}
+
+func TestNodeIterator(t *testing.T) {
+	trie := patricia.New()
+	for _, key := range []string{"do", "dog", "doge", "horse", "dot"} {
+		require.NoError(t, trie.Put([]byte(key), bytes.Repeat([]byte(key), 8)))
+	}
+
+	var (
+		it    = patricia.NewNodeIterator(trie, nil)
+		types = map[patricia.NodeType]int{}
+		paths [][]byte
+	)
+	for it.Next() {
+		if len(paths) == 0 {
+			// the root is always referenced by hash.
+			assert.Equal(t, trie.Root(), it.Hash())
+		}
+		types[it.Type()]++
+		paths = append(paths, it.Path())
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, map[patricia.NodeType]int{
+		patricia.NodeTypeBranch:    3,
+		patricia.NodeTypeExtension: 3,
+		patricia.NodeTypeLeaf:      3,
+	}, types)
+	assert.True(t, sort.SliceIsSorted(paths, func(i, j int) bool { return bytes.Compare(paths[i], paths[j]) < 0 }))
+	assert.Equal(t, "extension", patricia.NodeTypeExtension.String())
+}
@@ -2,6 +2,7 @@ package patricia
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/butcher-of-blaviken/merkle/common"
 	gethCommon "github.com/ethereum/go-ethereum/common"
@@ -11,20 +12,60 @@ import (
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
+var (
+	// ErrMissingNode is returned when a node referenced by hash
+	// cannot be found.
+	ErrMissingNode = fmt.Errorf("missing trie node")
+	// ErrMalformedNode is returned when a node cannot be decoded.
+	ErrMalformedNode = fmt.Errorf("malformed trie node")
+	// ErrNoDatabase is returned when committing a trie that isn't
+	// backed by a database, or opening a non-empty one without a database.
+	ErrNoDatabase = fmt.Errorf("trie has no backing database")
+	// ErrCorruptNode is returned when a node of an unknown kind, or one
+	// holding data that can't be encoded, is found in the trie.
+	ErrCorruptNode = fmt.Errorf("corrupt trie node")
+	// ErrInvariant is returned when the trie is found in a state that Put
+	// and Delete never leave it in, e.g because it was built from corrupted
+	// or adversarial nodes. See Validate.
+	ErrInvariant = fmt.Errorf("trie invariant violated")
+
+	// emptyRoot is the root hash of an empty trie.
+	emptyRoot = crypto.Keccak256(rlp.EmptyString)
+)
+
 type mpt struct {
 	root mptNode
+	// db is where nodes referenced by hash are loaded from and committed
+	// to. It is nil for purely in-memory tries.
+	db ethdb.KeyValueStore
+
+	hasher hasherConfig
+	// unhashed is the number of changes since the root was last computed.
+	unhashed int
+
+	// witness is where touched nodes are recorded to, it is nil unless
+	// recording is on.
+	witness ethdb.KeyValueStore
+
+	// err is the first error Root or Update ran into, see Err.
+	err error
 }
 
 // Delete implements MPT
 // Delete deletes the value associated with the provided key from the trie.
 // Note that Del _does not_ return an error if the key is not in the trie.
 func (m *mpt) Delete(key []byte) error {
-	_, newRoot, err := m.delete(m.root, nil, common.BytesToNibbles(key))
+	nibbles := common.BytesToNibbles(key)
+	if err := m.recordPath(nibbles); err != nil {
+		return err
+	}
+	_, newRoot, err := m.delete(m.root, nil, nibbles)
 	if err != nil {
 		return err
 	}
 
 	m.root = newRoot
+	m.unhashed++
 
 	return nil
 }
@@ -39,7 +80,33 @@ func (m *mpt) delete(n mptNode, prefix, key []byte) (dirty bool, newRoot mptNode
 	switch n := n.(type) {
 	case nil:
 		return false, nil, nil
+	case hashNode:
+		resolved, err := m.resolve(n)
+		if err != nil {
+			return false, n, err
+		}
+		// keep the reference if nothing was deleted, so that the subtree
+		// doesn't needlessly stay in memory.
+		dirty, newRoot, err = m.delete(resolved, prefix, key)
+		if !dirty || err != nil {
+			return false, n, err
+		}
+		return true, newRoot, nil
 	case *branchNode:
+		if len(key) == 0 {
+			// the key ends at n, its value is stored in n itself.
+			if n.value == nil {
+				return false, n, nil
+			}
+			n = n.copy()
+			n.value = nil
+			newRoot, err = m.reduce(n, prefix)
+			if err != nil {
+				return false, n, err
+			}
+			return true, newRoot, nil
+		}
+
 		// Case 1. n.children[key[0]] == nil, in which case the key is not present in the trie.
 		// Case 2. n.children[key[0]] != nil, in which case we recursively delete.
 		// The returned root is the _new_ root of the subtree previously rooted at
@@ -49,88 +116,82 @@ func (m *mpt) delete(n mptNode, prefix, key []byte) (dirty bool, newRoot mptNode
 			return false, n, err
 		}
 
-		// update the subtree reference.
+		// update the subtree reference in a copy, n may be shared
+		// with other tries.
+		n = n.copy()
 		n.children[key[0]] = newRoot
 
-		// Because n is a branch node, it must've contained at least two children
-		// before the delete operation. Otherwise, it would just be an extension node.
-		// Case 1. newRoot != nil, in which case n still has at least 2 children,
-		// and can remain a branch node.
+		// Case 1. newRoot != nil, in which case n still holds as many
+		// children and values as before, and can remain a branch node.
 		// Case 2. newRoot == nil, in which case n has one less child, and we should
-		// check if we can reduce it to an extension node.
+		// check if it can be reduced.
 		if newRoot != nil {
 			return true, n, nil
 		}
-
-		nonNilIndex := nonNilOnlyChildIndex(n.children[:])
-		if nonNilIndex >= 0 {
-			if nonNilIndex < 16 {
-				cnode := n.children[nonNilIndex]
-				switch cn := cnode.(type) {
-				case *extensionNode:
-					// If the only child of this branch is an extension node,
-					// merge them together to form a single extension node.
-					k := append([]byte{byte(nonNilIndex)}, cn.path...)
-					return true, &extensionNode{
-						path: k,
-						next: cn.next,
-					}, nil
-				case *leafNode:
-					// If the only child of this branch is a leaf node,
-					// merge them together to form a single leaf node.
-					return true, &leafNode{
-						path:  append([]byte{byte(nonNilIndex)}, cn.path...),
-						value: cn.value,
-					}, nil
-				}
-			}
-
-			return true, &extensionNode{[]byte{byte(nonNilIndex)}, n.children[nonNilIndex]}, nil
+		newRoot, err = m.reduce(n, prefix)
+		if err != nil {
+			return false, n, err
 		}
-		// n still contains at least two values and cannot be reduced.
-		return true, n, nil
+		return true, newRoot, nil
 	case *extensionNode:
 		prefixLength := len(common.ExtractCommonPrefix(key, n.path))
-		// Case 1. len(n.path) > prefixLength.
-		// Case 2. len(key) == prefixLength
+		// Case 1. len(n.path) > prefixLength, the key diverges from the
+		// extension or ends within it, so it's not in the trie.
+		// Case 2. len(n.path) == prefixLength, the key continues in the
+		// subtrie.
 		if len(n.path) > prefixLength {
 			return false, n, nil
 		}
 
-		// The key is longer than n.path. Remove the remaining suffix
-		// from the subtrie. Child can never be nil here since the
-		// subtrie must contain at least two other values with keys
-		// longer than n.path.
 		dirty, child, err := m.delete(n.next, append(prefix, key[:len(n.path)]...), key[len(n.path):])
 		if !dirty || err != nil {
 			return false, n, err
 		}
 		switch child := child.(type) {
+		case nil:
+			// the subtrie held a single key. This can't happen in tries
+			// built by Put, since extensions always lead to branches with
+			// at least two entries, but there's nothing left to extend.
+			return true, nil, nil
 		case *extensionNode:
 			// merge two extension nodes into one by stitching their paths
 			// together.
-			return true, &extensionNode{common.Concat(n.path, child.path), child.next}, nil
+			return true, &extensionNode{path: common.Concat(n.path, child.path), next: child.next}, nil
 		case *leafNode:
-			panic("insertion variant inviolated")
+			// the branch below n was reduced to a leaf, which absorbs
+			// the path of n.
+			return true, &leafNode{path: common.Concat(n.path, child.path), value: child.value}, nil
 		default:
-			// possible cases are nil and branch node.
-			// in both cases we can just point to the subtree without having
-			// to merge it.
-			// Note that it's impossible that child is a leaf node, since this
-			// violates the insertion invariant.
-			return true, &extensionNode{n.path, child}, nil
+			// the child is still a branch node, we can just point to
+			// the subtree without having to merge it.
+			return true, &extensionNode{path: n.path, next: child}, nil
 		}
 	case *leafNode:
+		// the leaf holds the key only if the rest of the key is its path.
+		if !bytes.Equal(key, n.path) {
+			return false, n, nil
+		}
 		return true, nil, nil
 	default:
-		panic("unknown node type") // impossible
+		return false, n, fmt.Errorf("%w: unexpected %T at %x", ErrCorruptNode, n, prefix)
 	}
 }
 
 // Get implements MPT
 func (m *mpt) Get(key []byte) (value []byte, err error) {
-	node := m.root
 	nibbles := common.BytesToNibbles(key)
+	if err := m.recordPath(nibbles); err != nil {
+		return nil, err
+	}
+	return get(m.root, nibbles, m.resolve)
+}
+
+// resolver loads the node referenced by the given hash.
+type resolver func(h hashNode) (mptNode, error)
+
+// get looks up the value stored under nibbles in the trie rooted at node,
+// using resolve to load nodes that are referenced by hash.
+func get(node mptNode, nibbles []byte, resolve resolver) (value []byte, err error) {
 	for {
 		if node == nil {
 			return nil, common.ErrKeyNotFound
@@ -171,16 +232,26 @@ func (m *mpt) Get(key []byte) (value []byte, err error) {
 			// otherwise, we're at a leaf (i.e no more child nodes) and we haven't
 			// found the provided path.
 			return nil, common.ErrKeyNotFound
+		case hashNode:
+			// load the node and look at it again, without keeping it in memory.
+			node, err = resolve(n)
+			if err != nil {
+				return nil, err
+			}
 		default:
-			panic("unexpected node kind - bug?")
+			return nil, fmt.Errorf("%w: unexpected %T", ErrCorruptNode, n)
 		}
 	}
 }
 
 // Put implements MPT
 func (m *mpt) Put(key []byte, value []byte) error {
+	m.unhashed++
 	node := &m.root
 	nibbles := common.BytesToNibbles(key)
+	if err := m.recordPath(nibbles); err != nil {
+		return err
+	}
 	for {
 		// case: NULL node
 		if *node == nil {
@@ -193,6 +264,10 @@ func (m *mpt) Put(key []byte, value []byte) error {
 
 		switch n := (*node).(type) {
 		case *branchNode:
+			// the branch changes either way, directly or through one
+			// of its children, so it's replaced by a copy.
+			n = n.copy()
+			*node = n
 			if len(nibbles) > 0 {
 				node = &n.children[nibbles[0]]
 				nibbles = nibbles[1:]
@@ -239,7 +314,8 @@ func (m *mpt) Put(key []byte, value []byte) error {
 				} else if commonPrefixLen == len(nibbles) {
 					branch.value = value
 				} else {
-					panic("invariant violated: len(commonPrefix) > len(nibbles)") // should be impossible
+					// the common prefix can't be longer than nibbles.
+					return fmt.Errorf("%w: common prefix longer than key", ErrInvariant)
 				}
 
 				if len(newExtPath) == 0 {
@@ -254,6 +330,8 @@ func (m *mpt) Put(key []byte, value []byte) error {
 			}
 
 			// case 2.
+			n = n.copy()
+			*node = n
 			nibbles = nibbles[commonPrefixLen:]
 			node = &n.next
 			continue
@@ -264,9 +342,13 @@ func (m *mpt) Put(key []byte, value []byte) error {
 			)
 
 			// if the common prefix matches both the remaining nibbles and
-			// the leaf path, then we can update the leaf value in-place.
+			// the leaf path, then we can replace the leaf with one holding
+			// the new value.
 			if commonPrefixLen == len(nibbles) && commonPrefixLen == len(n.path) {
-				n.value = value
+				*node = &leafNode{
+					path:  n.path,
+					value: value,
+				}
 				return nil
 			}
 
@@ -310,31 +392,222 @@ func (m *mpt) Put(key []byte, value []byte) error {
 			}
 
 			return nil
+		case hashNode:
+			// the node is about to change, so it has to be loaded in memory.
+			resolved, err := m.resolve(n)
+			if err != nil {
+				return err
+			}
+			*node = resolved
 		default:
-			panic("unexpected node kind - bug?")
+			return fmt.Errorf("%w: unexpected %T", ErrCorruptNode, n)
 		}
 	}
 }
 
 // Root returns the merkle root of this MPT
+// Root returns nil if the trie holds a node that can't be encoded, which
+// can only happen for tries opened from corrupted nodes, see Validate and
+// Err.
 func (m *mpt) Root() []byte {
+	h, err := m.rootHash()
+	if err != nil {
+		m.setErr(err)
+		return nil
+	}
+	return h
+}
+
+// rootHash returns the merkle root of this MPT, see Root.
+func (m *mpt) rootHash() ([]byte, error) {
 	if m.root == nil {
-		return crypto.Keccak256(rlp.EmptyString)
+		return emptyRoot, nil
 	}
+	m.hash()
 	return hash(m.root)
 }
 
+// Err implements MPT
+func (m *mpt) Err() error {
+	return m.err
+}
+
+func (m *mpt) setErr(err error) {
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+// hash hashes the children of the top-level branch concurrently, if parallel
+// hashing is enabled and enough keys changed since the root was last computed.
+func (m *mpt) hash() {
+	if m.unhashed == 0 {
+		return
+	}
+	if m.hasher.parallel && m.unhashed >= m.hasher.threshold {
+		m.hashChildren()
+	}
+	m.unhashed = 0
+}
+
+// Copy implements MPT
+// Copy doesn't copy any nodes: the copy shares all nodes with m, and since
+// nodes are never modified in place, changes to either trie don't affect the
+// other. If m is recording, the copy records to the same witness.
+// The root of m is computed first, which fills the caches of all the shared
+// nodes, so that m and the copy can be used on different goroutines. Apart
+// from that, which only hashes the nodes that changed since the root was
+// last computed, Copy is O(1).
+func (m *mpt) Copy() common.MPT {
+	m.Root()
+	return &mpt{
+		root:     m.root,
+		db:       m.db,
+		hasher:   m.hasher,
+		unhashed: m.unhashed,
+		witness:  m.witness,
+	}
+}
+
+// Commit implements Committer
+// Commit writes every node that isn't in the database yet to it, keyed by
+// the node hash, and replaces those nodes in memory with references to
+// their hashes. It returns the root hash of the trie.
+func (m *mpt) Commit() (root []byte, err error) {
+	if m.db == nil {
+		return nil, ErrNoDatabase
+	}
+	if m.root == nil {
+		return emptyRoot, nil
+	}
+
+	m.hash()
+	batch := m.db.NewBatch()
+	newRoot, err := commit(m.root, batch)
+	if err != nil {
+		return nil, err
+	}
+	// the root must always be stored by its hash, even if its encoding
+	// is short enough to be embedded.
+	if _, ok := newRoot.(hashNode); !ok {
+		enc, err := serialize(newRoot)
+		if err != nil {
+			return nil, err
+		}
+		h := crypto.Keccak256(enc)
+		if err := batch.Put(h, enc); err != nil {
+			return nil, err
+		}
+		newRoot = hashNode(h)
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+
+	m.root = newRoot
+	return hash(m.root)
+}
+
+// commit writes the subtree rooted at n to w bottom-up and returns what
+// should take its place in its parent: a hashNode for nodes that are stored,
+// or n itself (with committed children) for nodes small enough to be embedded.
+func commit(n mptNode, w ethdb.KeyValueWriter) (mptNode, error) {
+	switch n := n.(type) {
+	case nil, hashNode:
+		return n, nil
+	}
+	// nodes that weren't modified since they were loaded are already
+	// in the database, along with all their children.
+	if n.cache().persisted {
+		enc, err := serialize(n)
+		if err != nil {
+			return nil, err
+		}
+		if len(enc) >= 32 {
+			return hashNode(crypto.Keccak256(enc)), nil
+		}
+		return n, nil
+	}
+
+	switch n := n.(type) {
+	case *extensionNode:
+		next, err := commit(n.next, w)
+		if err != nil {
+			return nil, err
+		}
+		return store(&extensionNode{path: n.path, next: next}, w)
+	case *branchNode:
+		b := &branchNode{value: n.value}
+		for i, c := range n.children {
+			child, err := commit(c, w)
+			if err != nil {
+				return nil, err
+			}
+			b.children[i] = child
+		}
+		return store(b, w)
+	default:
+		return store(n, w)
+	}
+}
+
+// store writes n to w if it is too large to be embedded in its parent.
+func store(n mptNode, w ethdb.KeyValueWriter) (mptNode, error) {
+	enc, err := serialize(n)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc) < 32 {
+		return n, nil
+	}
+	h := crypto.Keccak256(enc)
+	if err := w.Put(h, enc); err != nil {
+		return nil, err
+	}
+	return hashNode(h), nil
+}
+
+// resolve loads the node referenced by h from the backing database.
+func (m *mpt) resolve(h hashNode) (mptNode, error) {
+	if m.db == nil {
+		return nil, fmt.Errorf("%w: %x", ErrMissingNode, []byte(h))
+	}
+	enc, err := m.db.Get(h)
+	if err != nil || len(enc) == 0 {
+		return nil, fmt.Errorf("%w: %x", ErrMissingNode, []byte(h))
+	}
+	if m.witness != nil {
+		if err := m.witness.Put(h, enc); err != nil {
+			return nil, err
+		}
+	}
+	return decodeNode(enc)
+}
+
+// load returns n, resolving it first if it is a hashNode.
+func (m *mpt) load(n mptNode) (mptNode, error) {
+	if h, ok := n.(hashNode); ok {
+		return m.resolve(h)
+	}
+	return n, nil
+}
+
 // Reset implements types.TrieHasher
 func (m *mpt) Reset() {
 	m.root = nil
+	m.err = nil
 }
 
 // Update implements types.TrieHasher
+// Errors are recorded rather than returned, see Err.
 func (m *mpt) Update(key, value []byte) {
-	m.Put(key, value)
+	if err := m.Put(key, value); err != nil {
+		m.setErr(err)
+	}
 }
 
 // Hash implements types.TrieHasher
+// Errors are recorded rather than returned, see Err.
 func (m *mpt) Hash() gethCommon.Hash {
 	return gethCommon.BytesToHash(m.Root())
 }
@@ -342,66 +615,180 @@ func (m *mpt) Hash() gethCommon.Hash {
 // ProofFor constructs a merkle proof for the provided key.
 // The result contains all encoded nodes on the path to the
 // value at key. The value itself is also included in the last node.
-func (m *mpt) ProofFor(key []byte) ethdb.KeyValueReader {
-	var (
-		proofDB = rawdb.NewMemoryDatabase()
-		nibbles = common.BytesToNibbles(key)
-		node    = m.root
-	)
+// If key is not in the trie, the result contains the nodes on the path
+// down to the point where key diverges from the trie (an empty branch slot,
+// a mismatching extension or a different leaf), which proves its absence.
+func (m *mpt) ProofFor(key []byte) (ethdb.KeyValueReader, error) {
+	proofDB := rawdb.NewMemoryDatabase()
+	if err := m.prove(common.BytesToNibbles(key), proofDB); err != nil {
+		return nil, err
+	}
+	return proofDB, nil
+}
+
+// ProofForKeys constructs a single merkle proof for all of the provided keys.
+// The result is the union of the proofs ProofFor would return for each key,
+// so the nodes that are shared by several paths are only included once.
+func (m *mpt) ProofForKeys(keys [][]byte) (ethdb.KeyValueReader, error) {
+	proofDB := rawdb.NewMemoryDatabase()
+	for _, key := range keys {
+		if err := m.prove(common.BytesToNibbles(key), proofDB); err != nil {
+			return nil, err
+		}
+	}
+	return proofDB, nil
+}
+
+// prove writes the encoded nodes on the path of nibbles to proofDB.
+// See ProofFor for details.
+func (m *mpt) prove(nibbles []byte, proofDB ethdb.KeyValueWriter) error {
+	next := m.root
 	for {
-		proofDB.Put(hash(node), serialize(node))
+		node, err := m.load(next)
+		if err != nil {
+			return err
+		}
 
+		// nothing left to prove, key is absent.
 		if node == nil {
-			return proofDB
+			return nil
+		}
+
+		// the hash isn't cached for embedded nodes, and computing it
+		// mustn't write to nodes that may be shared with other tries.
+		enc, err := serialize(node)
+		if err != nil {
+			return err
+		}
+		if err := proofDB.Put(crypto.Keccak256(enc), enc); err != nil {
+			return err
 		}
 
 		switch n := node.(type) {
 		case *leafNode:
-			// if the remaining nibbles match the path in the leaf then we've found
-			// the value.
-			if bytes.Equal(nibbles, n.path) {
-				return proofDB
-			}
-			// key not found
+			// the leaf either holds the value or proves that there
+			// is no value at key.
 			return nil
 		case *extensionNode:
 			// extract the common prefix from the nibbles that
 			// remain and the extension path.
 			commonPrefix := common.ExtractCommonPrefix(n.path, nibbles)
 			if len(commonPrefix) < len(n.path) {
-				// key not found
+				// key diverges from the extension, it's absent.
 				return nil
 			}
 			// "skip" through all the common nibbles and jump to the next node.
 			// this is where the optimization kicks in.
 			nibbles = nibbles[len(commonPrefix):]
-			node = n.next
+			next = n.next
 		case *branchNode:
 			// check if we have a path for the first nibble
 			// and recursively continue
 			if len(nibbles) > 0 {
 				// the case where node is set to nil is handled above,
 				// no need to handle it here again.
-				node = n.children[nibbles[0]] // jump one level down
+				next = n.children[nibbles[0]] // jump one level down
 				nibbles = nibbles[1:]         // nibble off first nibble
 				continue
 			}
 
-			if n.value != nil {
-				return proofDB
-			}
-			return nil // key not found
+			// the branch value is either the value at key or empty.
+			return nil
 		default:
-			panic("unexpected node kind - bug?")
+			return fmt.Errorf("%w: unexpected %T", ErrCorruptNode, n)
 		}
 	}
 }
 
 // New returns an empty Merkle-Patricia trie ready for use.
-func New() common.MPT {
-	return &mpt{
+func New(opts ...Option) common.MPT {
+	m := &mpt{
 		root: nil,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Open returns the Merkle-Patricia trie with the given root hash, whose
+// nodes are stored in db. Nodes are only read from db when an operation
+// needs them, so opening a trie is cheap regardless of its size.
+// An empty root opens an empty trie, which db may be nil for.
+func Open(root []byte, db ethdb.KeyValueStore, opts ...Option) (common.MPT, error) {
+	m := &mpt{
+		db: db,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if len(root) == 0 || bytes.Equal(root, emptyRoot) {
+		return m, nil
+	}
+	if db == nil {
+		return nil, ErrNoDatabase
+	}
+	if ok, err := db.Has(root); err != nil || !ok {
+		return nil, fmt.Errorf("%w: %x", ErrMissingNode, root)
+	}
+	m.root = hashNode(gethCommon.CopyBytes(root))
+	return m, nil
+}
+
+// reduce returns the node that should replace the branch n, found at
+// prefix, after one of its children or its value was removed. A branch
+// needs at least two entries (children or value), with fewer it is merged
+// into a leaf or an extension.
+func (m *mpt) reduce(n *branchNode, prefix []byte) (mptNode, error) {
+	pos := nonNilOnlyChildIndex(n.children[:])
+	switch {
+	case pos == -1:
+		// n still contains at least two children and cannot be reduced.
+		return n, nil
+	case pos == -2:
+		// only the value, if any, is left.
+		if n.value == nil {
+			return nil, nil
+		}
+		return &leafNode{path: []byte{}, value: n.value}, nil
+	case n.value != nil:
+		// a child and the value.
+		return n, nil
+	}
+
+	// the child's kind decides how to merge, so it has to be
+	// loaded if it's only referenced by hash.
+	cnode, err := m.load(n.children[pos])
+	if err != nil {
+		return nil, err
+	}
+	// the child isn't on the path of the deleted key, but it's needed
+	// to replay the delete.
+	if err := m.record(cnode); err != nil {
+		return nil, err
+	}
+	switch cn := cnode.(type) {
+	case *extensionNode:
+		// If the only child of this branch is an extension node,
+		// merge them together to form a single extension node.
+		return &extensionNode{
+			path: common.Concat([]byte{byte(pos)}, cn.path),
+			next: cn.next,
+		}, nil
+	case *leafNode:
+		// If the only child of this branch is a leaf node,
+		// merge them together to form a single leaf node.
+		return &leafNode{
+			path:  common.Concat([]byte{byte(pos)}, cn.path),
+			value: cn.value,
+		}, nil
+	case *branchNode:
+		// the child stays a branch, n becomes an extension pointing
+		// to it.
+		return &extensionNode{path: []byte{byte(pos)}, next: n.children[pos]}, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected %T at %x", ErrCorruptNode, cn, append(prefix, byte(pos)))
+	}
 }
 
 // nonNilOnlyChildIndex returns the index of the only non-nil
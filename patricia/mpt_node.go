@@ -10,7 +10,24 @@ import (
 
 // mptNode is an interface that is implemented by all MPT node types.
 type mptNode interface {
-	preRLP() []any
+	preRLP() ([]any, error)
+	// cache returns the node's cached encoding and hash, or nil for nodes
+	// that don't have any.
+	cache() *nodeFlags
+}
+
+// nodeFlags caches the encoding and hash of a node, so that subtrees that
+// haven't changed don't have to be encoded again every time the root is
+// computed. Nodes are never modified once they're part of a trie, Put and
+// Delete replace the nodes on the path they change with fresh copies. The
+// cached flags therefore never go stale, and nodes can be shared between
+// copies of a trie.
+type nodeFlags struct {
+	enc  []byte // nil if not computed yet
+	hash []byte // nil if not computed yet
+	// persisted is set for nodes that were loaded from the database and
+	// haven't changed since, i.e that aren't dirty.
+	persisted bool
 }
 
 // MPT have four kinds of nodes.
@@ -25,23 +42,50 @@ var (
 	_ mptNode = &branchNode{}
 	_ mptNode = &leafNode{}
 	_ mptNode = &extensionNode{}
+	_ mptNode = hashNode{}
 )
 
+// hashNode is a reference to a node that lives in a database rather than
+// in memory, keyed by the keccak hash of its encoding. It is only resolved
+// into an actual node when an operation needs to descend into it.
+type hashNode []byte
+
+// preRLP implements mptNode
+// A hashNode is never serialized by itself, its parent embeds the hash
+// directly (see ref).
+func (h hashNode) preRLP() ([]any, error) {
+	return nil, fmt.Errorf("%w: hash node %x can't be encoded", ErrInvariant, []byte(h))
+}
+
+// cache implements mptNode
+func (h hashNode) cache() *nodeFlags {
+	return nil
+}
+
 // leafNode is a node in an mpt that has no children. They contain
 // what remains of the path (from the root) and an rlp-encoded value
 // which could mean e.g the account state (in ethereum).
 type leafNode struct {
 	path  []byte // all nibbles
 	value []byte
+	flags nodeFlags
+}
+
+// cache implements mptNode
+func (l *leafNode) cache() *nodeFlags {
+	return &l.flags
 }
 
 // preRLP implements mptNode
-func (l *leafNode) preRLP() []any {
-	ce := common.CompactEncode(l.path, true)
+func (l *leafNode) preRLP() ([]any, error) {
+	ce, err := common.CompactEncode(l.path, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptNode, err)
+	}
 	return []any{
 		ce,
 		l.value,
-	}
+	}, nil
 }
 
 // extensionNode is an optimization in mpt's which allows us to "shortcut"
@@ -49,66 +93,267 @@ func (l *leafNode) preRLP() []any {
 // Since 64 character paths in ethereum are unlikely to have many collisions,
 // this saves on a lot of space (otherwise, your tree will be much deeper).
 type extensionNode struct {
-	path []byte // all nibbles
-	next mptNode
+	path  []byte // all nibbles
+	next  mptNode
+	flags nodeFlags
+}
+
+// cache implements mptNode
+func (e *extensionNode) cache() *nodeFlags {
+	return &e.flags
 }
 
 // preRLP implements mptNode
-func (e *extensionNode) preRLP() []any {
-	ce := common.CompactEncode(e.path, false)
-	r := []any{
-		ce,
+func (e *extensionNode) preRLP() ([]any, error) {
+	ce, err := common.CompactEncode(e.path, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptNode, err)
 	}
-	if nextRLP := serialize(e.next); len(nextRLP) >= 32 {
-		r = append(r, crypto.Keccak256(nextRLP))
-	} else {
-		r = append(r, e.next.preRLP())
+	next, err := ref(e.next)
+	if err != nil {
+		return nil, err
 	}
-	return r
+	return []any{
+		ce,
+		next,
+	}, nil
 }
 
 type branchNode struct {
 	children [16]mptNode // 16 nodes + value = 17 items total
 	value    []byte
+	flags    nodeFlags
+}
+
+// cache implements mptNode
+func (b *branchNode) cache() *nodeFlags {
+	return &b.flags
 }
 
 // preRLP implements mptNode
-func (b *branchNode) preRLP() (r []any) {
+func (b *branchNode) preRLP() (r []any, err error) {
 	for _, c := range b.children {
-		if c == nil {
-			r = append(r, []byte{})
-		} else {
-			if cRLP := serialize(c); len(cRLP) >= 32 {
-				r = append(r, crypto.Keccak256(cRLP))
-			} else {
-				r = append(r, c.preRLP())
-			}
+		child, err := ref(c)
+		if err != nil {
+			return nil, err
 		}
+		r = append(r, child)
 	}
 	r = append(r, b.value)
-	if len(r) != 17 {
-		panic(fmt.Sprintf("invariant violated: branch preRLP must be length 17, got %d", len(r)))
+	return r, nil
+}
+
+// ref returns how the given child node is represented inside its parent.
+// Nodes whose encoding is shorter than 32 bytes are embedded as is, larger
+// nodes are referenced by their hash.
+func ref(node mptNode) (any, error) {
+	switch n := node.(type) {
+	case nil:
+		return []byte{}, nil
+	case hashNode:
+		return []byte(n), nil
 	}
-	return
+	enc, err := serialize(node)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc) >= 32 {
+		return hash(node)
+	}
+	// embed the (cached) encoding rather than encoding the node again.
+	return rlp.RawValue(enc), nil
+}
+
+// copy returns a copy of b without its cached flags, which can be modified
+// without affecting the tries that share b.
+func (b *branchNode) copy() *branchNode {
+	return &branchNode{children: b.children, value: b.value}
 }
 
-func hash(node mptNode) []byte {
-	return crypto.Keccak256(serialize(node))
+// copy returns a copy of e without its cached flags, which can be modified
+// without affecting the tries that share e.
+func (e *extensionNode) copy() *extensionNode {
+	return &extensionNode{path: e.path, next: e.next}
 }
 
-func serialize(node mptNode) []byte {
+// hash returns the keccak hash of the encoding of node. Errors can only
+// occur for nodes that Put and Delete never create, e.g nodes with paths
+// that don't consist of nibbles.
+func hash(node mptNode) ([]byte, error) {
+	if h, ok := node.(hashNode); ok {
+		return h, nil
+	}
+	if node == nil {
+		return crypto.Keccak256(rlp.EmptyString), nil
+	}
+	flags := node.cache()
+	if flags.hash != nil {
+		return flags.hash, nil
+	}
+	enc, err := serialize(node)
+	if err != nil {
+		return nil, err
+	}
+	h := crypto.Keccak256(enc)
+	// embedded nodes are shared by copies of a trie without their hash,
+	// see mpt.Copy, so it isn't cached for them.
+	if len(enc) >= 32 {
+		flags.hash = h
+	}
+	return h, nil
+}
+
+// serialize returns the RLP encoding of node, see hash for errors.
+func serialize(node mptNode) ([]byte, error) {
 	var preRLP any
 
 	if node == nil {
 		preRLP = []byte{}
+	} else if _, ok := node.(hashNode); ok {
+		return nil, fmt.Errorf("%w: hash node can't be encoded", ErrInvariant)
+	} else if enc := node.cache().enc; enc != nil {
+		return enc, nil
 	} else {
-		preRLP = node.preRLP()
+		items, err := node.preRLP()
+		if err != nil {
+			return nil, err
+		}
+		preRLP = items
 	}
 
 	rlpEncoded, err := rlp.EncodeToBytes(preRLP)
 	if err != nil {
-		panic(err) // should never happen
+		return nil, fmt.Errorf("%w: %v", ErrCorruptNode, err)
 	}
 
-	return rlpEncoded
+	if node != nil {
+		node.cache().enc = rlpEncoded
+	}
+	return rlpEncoded, nil
+}
+
+// decodeNode parses a single RLP-encoded node, as produced by serialize.
+// Children that are referenced by hash are returned as hashNodes, embedded
+// children are decoded in place.
+func decodeNode(buf []byte) (mptNode, error) {
+	kind, content, rest, err := rlp.Split(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNode, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: trailing bytes after node", ErrMalformedNode)
+	}
+	if kind != rlp.List {
+		// the only valid string encoding is the NULL node.
+		if len(content) == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: unexpected string", ErrMalformedNode)
+	}
+
+	numElems, err := rlp.CountValues(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNode, err)
+	}
+	var node mptNode
+	switch numElems {
+	case 2:
+		node, err = decodeShort(content)
+	case 17:
+		node, err = decodeBranch(content)
+	default:
+		return nil, fmt.Errorf("%w: invalid number of list elements: %d", ErrMalformedNode, numElems)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the node is known to be stored as is, there's no need to encode it again.
+	*node.cache() = nodeFlags{
+		enc:       buf,
+		persisted: true,
+	}
+	return node, nil
+}
+
+// decodeShort decodes the contents of a 2-item node, i.e a leaf or an
+// extension node. The compact path flags tell the two apart.
+func decodeShort(elems []byte) (mptNode, error) {
+	encodedPath, rest, err := rlp.SplitString(elems)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNode, err)
+	}
+	path, isLeaf, err := common.CompactDecode(encodedPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNode, err)
+	}
+
+	if isLeaf {
+		value, _, err := rlp.SplitString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedNode, err)
+		}
+		return &leafNode{
+			path:  path,
+			value: value,
+		}, nil
+	}
+
+	next, _, err := decodeRef(rest)
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		return nil, fmt.Errorf("%w: extension node without child", ErrMalformedNode)
+	}
+	return &extensionNode{
+		path: path,
+		next: next,
+	}, nil
+}
+
+// decodeBranch decodes the contents of a 17-item branch node.
+func decodeBranch(elems []byte) (mptNode, error) {
+	var (
+		b   = &branchNode{}
+		err error
+	)
+	for i := range b.children {
+		b.children[i], elems, err = decodeRef(elems)
+		if err != nil {
+			return nil, err
+		}
+	}
+	value, _, err := rlp.SplitString(elems)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNode, err)
+	}
+	if len(value) > 0 {
+		b.value = value
+	}
+	return b, nil
+}
+
+// decodeRef decodes a child reference as produced by ref, and returns
+// the remaining bytes of buf.
+func decodeRef(buf []byte) (node mptNode, rest []byte, err error) {
+	kind, content, rest, err := rlp.Split(buf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMalformedNode, err)
+	}
+	switch {
+	case kind == rlp.List:
+		// embedded node, which must be shorter than a hash.
+		size := len(buf) - len(rest)
+		if size >= 32 {
+			return nil, nil, fmt.Errorf("%w: embedded node of size %d", ErrMalformedNode, size)
+		}
+		node, err = decodeNode(buf[:size])
+		return node, rest, err
+	case kind == rlp.String && len(content) == 0:
+		return nil, rest, nil
+	case kind == rlp.String && len(content) == 32:
+		return hashNode(content), rest, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: invalid child reference of size %d", ErrMalformedNode, len(content))
+	}
 }
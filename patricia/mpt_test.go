@@ -2,13 +2,19 @@ package patricia_test
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"sync"
 	"testing"
 
+	"github.com/butcher-of-blaviken/merkle/common"
 	"github.com/butcher-of-blaviken/merkle/patricia"
+	gethCommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/rlp"
 	gethTrie "github.com/ethereum/go-ethereum/trie"
 	"github.com/stretchr/testify/assert"
@@ -133,6 +139,64 @@ func TestMPT_Root(t *testing.T) {
 	})
 }
 
+func TestMPT_RootCaching(t *testing.T) {
+	// the root is computed after every change, so stale cached hashes
+	// anywhere on the changed paths would show up as a mismatch.
+	check := func(t *testing.T, trie common.MPT) {
+		gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+		for i := 0; i < 200; i++ {
+			key := crypto.Keccak256([]byte{byte(i % 64)})[:1+i%5]
+			switch i % 3 {
+			case 0, 1:
+				require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value-%d", i))))
+				gTrie.Update(key, []byte(fmt.Sprintf("value-%d", i)))
+			case 2:
+				if _, err := trie.Get(key); err != nil {
+					continue
+				}
+				require.NoError(t, trie.Delete(key))
+				gTrie.Delete(key)
+			}
+			require.Equal(t, gTrie.Hash().Bytes(), trie.Root(), "mismatch after operation %d", i)
+		}
+	}
+
+	t.Run("in memory", func(t *testing.T) {
+		check(t, patricia.New())
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, trie.Put(crypto.Keccak256([]byte{byte(i)}), []byte{byte(i)}))
+		}
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+
+		trie, err = patricia.Open(root, db)
+		require.NoError(t, err)
+		// loading nodes without changing them doesn't change the root.
+		for i := 0; i < 100; i++ {
+			_, err := trie.Get(crypto.Keccak256([]byte{byte(i)}))
+			require.NoError(t, err)
+		}
+		require.NoError(t, trie.Put(crypto.Keccak256([]byte{0}), []byte{0}))
+		require.Equal(t, root, trie.Root())
+		newRoot, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		require.Equal(t, root, newRoot)
+
+		// deleting every key of a committed trie, whose nodes are loaded
+		// from the database, leaves the empty trie.
+		for i := 0; i < 100; i++ {
+			require.NoError(t, trie.Delete(crypto.Keccak256([]byte{byte(i)})))
+		}
+		require.Equal(t, patricia.New().Root(), trie.Root())
+	})
+}
+
 func TestMPT_ProofFor(t *testing.T) {
 	t.Run("simple trie", func(t *testing.T) {
 		trie := patricia.New()
@@ -155,7 +219,8 @@ func TestMPT_ProofFor(t *testing.T) {
 		gHash := gTrie.Hash()
 		require.Equal(t, gHash, rootHash)
 
-		proof := trie.ProofFor([]byte{1, 2, 3, 4})
+		proof, err := trie.ProofFor([]byte{1, 2, 3, 4})
+		require.NoError(t, err)
 		val, err := gethTrie.VerifyProof(trie.Hash(), []byte{1, 2, 3, 4}, proof)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, val)
@@ -182,7 +247,8 @@ func TestMPT_ProofFor(t *testing.T) {
 
 		proofKey, err := rlp.EncodeToBytes(uint64(2))
 		require.NoError(t, err)
-		proof := mpt.ProofFor(proofKey)
+		proof, err := mpt.ProofFor(proofKey)
+		require.NoError(t, err)
 		val, err := gethTrie.VerifyProof(mpt.Hash(), proofKey, proof)
 		require.NoError(t, err)
 		require.NotEmpty(t, val)
@@ -324,4 +390,574 @@ func TestMPT_Delete(t *testing.T) {
 		gHash = gTrie.Hash()
 		require.Equal(t, gHash, rootHash)
 	})
+
+	t.Run("absent keys", func(t *testing.T) {
+		trie := patricia.New()
+		require.NoError(t, trie.Put([]byte{1, 2, 3, 4}, []byte("hello")))
+		require.NoError(t, trie.Put([]byte{1, 2, 5, 4}, []byte("world")))
+		root := trie.Root()
+
+		// keys that end at a leaf, in a branch or in the middle of a
+		// leaf path, or that are longer than a leaf path.
+		for _, key := range [][]byte{{1, 2, 3, 5}, {1, 2}, {1, 2, 3}, {1, 2, 3, 4, 5}} {
+			require.NoError(t, trie.Delete(key))
+			require.Equal(t, root, trie.Root())
+		}
+	})
+
+	t.Run("prefix-overlapping keys", func(t *testing.T) {
+		keys := [][]byte{
+			{},
+			{0x12},
+			{0x12, 0x34},
+			{0x12, 0x34, 0x56},
+			{0x12, 0x35},
+			{0x12, 0x34, 0x57},
+			{0x40},
+			{0x40, 0x00, 0x00},
+			[]byte("do"),
+			[]byte("dog"),
+			[]byte("doge"),
+			[]byte("horse"),
+		}
+		value := func(key []byte) []byte {
+			// long enough that some nodes are referenced by hash.
+			return append([]byte("a value for the key "), key...)
+		}
+		orders := map[string][]int{
+			"ascending":  {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+			"descending": {11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+			"shuffled":   {2, 7, 0, 9, 4, 11, 1, 6, 3, 10, 5, 8},
+		}
+		for name, order := range orders {
+			t.Run(name, func(t *testing.T) {
+				trie := patricia.New()
+				gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+				for _, key := range keys {
+					require.NoError(t, trie.Put(key, value(key)))
+					gTrie.Update(key, value(key))
+				}
+				require.Equal(t, gTrie.Hash(), trie.Hash())
+
+				for i, idx := range order {
+					require.NoError(t, trie.Delete(keys[idx]))
+					require.NoError(t, gTrie.TryDelete(keys[idx]))
+					require.Equal(t, gTrie.Hash(), trie.Hash(), "after deleting %x", keys[idx])
+
+					_, err := trie.Get(keys[idx])
+					require.ErrorIs(t, err, common.ErrKeyNotFound)
+					for _, other := range order[i+1:] {
+						v, err := trie.Get(keys[other])
+						require.NoError(t, err)
+						require.Equal(t, value(keys[other]), v)
+					}
+					violations, err := patricia.Validate(trie)
+					require.NoError(t, err)
+					require.Empty(t, violations)
+				}
+				require.Equal(t, patricia.New().Hash(), trie.Hash())
+			})
+		}
+	})
+
+	t.Run("committed trie", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+		for i := 0; i < 50; i++ {
+			// every key is a prefix of the next 3.
+			key := bytes.Repeat([]byte{byte(i / 4)}, i%4+1)
+			val := bytes.Repeat([]byte{byte(i)}, 40)
+			require.NoError(t, trie.Put(key, val))
+			gTrie.Update(key, val)
+		}
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+
+		// the nodes are loaded from the database when they're merged.
+		reopened, err := patricia.Open(root, db)
+		require.NoError(t, err)
+		for i := 0; i < 50; i += 3 {
+			key := bytes.Repeat([]byte{byte(i / 4)}, i%4+1)
+			require.NoError(t, reopened.Delete(key))
+			gTrie.Delete(key)
+			require.Equal(t, gTrie.Hash(), reopened.Hash())
+		}
+	})
+}
+
+func TestMPT_OpenCommit(t *testing.T) {
+	t.Run("no database", func(t *testing.T) {
+		trie := patricia.New()
+		require.NoError(t, trie.Put([]byte{1, 2, 3, 4}, []byte("hello")))
+		_, err := trie.(patricia.Committer).Commit()
+		assert.ErrorIs(t, err, patricia.ErrNoDatabase)
+
+		_, err = patricia.Open(trie.Root(), nil)
+		assert.ErrorIs(t, err, patricia.ErrNoDatabase)
+	})
+
+	t.Run("unknown root", func(t *testing.T) {
+		_, err := patricia.Open(crypto.Keccak256([]byte("nope")), rawdb.NewMemoryDatabase())
+		assert.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("empty trie", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		assert.Equal(t, "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421", hexutil.Encode(root))
+
+		trie, err = patricia.Open(root, db)
+		require.NoError(t, err)
+		_, err = trie.Get([]byte("not-there"))
+		assert.Error(t, err)
+	})
+
+	t.Run("commit and reopen", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+		for i := 0; i < 100; i++ {
+			key := crypto.Keccak256([]byte{byte(i)})
+			require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value-%d", i))))
+			gTrie.Update(key, []byte(fmt.Sprintf("value-%d", i)))
+		}
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		require.Equal(t, gTrie.Hash().Bytes(), root)
+
+		// reads and writes work on the committed trie as well as on a
+		// freshly opened one.
+		reopened, err := patricia.Open(root, db)
+		require.NoError(t, err)
+		for _, trie := range []common.MPT{trie, reopened} {
+			require.Equal(t, root, trie.Root())
+			for i := 0; i < 100; i++ {
+				v, err := trie.Get(crypto.Keccak256([]byte{byte(i)}))
+				require.NoError(t, err)
+				assert.Equal(t, []byte(fmt.Sprintf("value-%d", i)), v)
+			}
+		}
+
+		require.NoError(t, reopened.Put([]byte("new key"), []byte("new value")))
+		gTrie.Update([]byte("new key"), []byte("new value"))
+		for i := 0; i < 50; i++ {
+			require.NoError(t, reopened.Delete(crypto.Keccak256([]byte{byte(i)})))
+			gTrie.Delete(crypto.Keccak256([]byte{byte(i)}))
+		}
+		require.Equal(t, gTrie.Hash().Bytes(), reopened.Root())
+
+		newRoot, err := reopened.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		require.Equal(t, gTrie.Hash().Bytes(), newRoot)
+
+		// the old version is still intact in the database.
+		old, err := patricia.Open(root, db)
+		require.NoError(t, err)
+		v, err := old.Get(crypto.Keccak256([]byte{0}))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value-0"), v)
+
+		// proofs can be built without loading the whole trie.
+		proof, err := old.ProofFor(crypto.Keccak256([]byte{0}))
+		require.NoError(t, err)
+		v, err = gethTrie.VerifyProof(gethCommon.BytesToHash(root), crypto.Keccak256([]byte{0}), proof)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value-0"), v)
+	})
+
+	t.Run("missing node", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for i := 0; i < 20; i++ {
+			require.NoError(t, trie.Put(crypto.Keccak256([]byte{byte(i)}), bytes.Repeat([]byte{byte(i)}, 32)))
+		}
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+
+		// remove the leaf of one key, others must still be readable since
+		// nodes are only loaded when needed.
+		trie = patricia.New()
+		for i := 0; i < 20; i++ {
+			require.NoError(t, trie.Put(crypto.Keccak256([]byte{byte(i)}), bytes.Repeat([]byte{byte(i)}, 32)))
+		}
+		proof, err := trie.ProofFor(crypto.Keccak256([]byte{0}))
+		require.NoError(t, err)
+		it := db.NewIterator(nil, nil)
+		for it.Next() {
+			if ok, _ := proof.Has(it.Key()); ok && !bytes.Equal(it.Key(), root) {
+				require.NoError(t, db.Delete(it.Key()))
+			}
+		}
+		it.Release()
+
+		reopened, err := patricia.Open(root, db)
+		require.NoError(t, err)
+		_, err = reopened.Get(crypto.Keccak256([]byte{0}))
+		assert.ErrorIs(t, err, patricia.ErrMissingNode)
+		v, err := reopened.Get(crypto.Keccak256([]byte{1}))
+		require.NoError(t, err)
+		assert.Equal(t, bytes.Repeat([]byte{1}, 32), v)
+	})
+
+	t.Run("corrupt node", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		// a list with three items isn't a node.
+		root := storeNode(t, db, []byte{1}, []byte{2}, []byte{3})
+		trie, err := patricia.Open(root, db)
+		require.NoError(t, err)
+
+		// errors come back from every operation rather than panics.
+		_, err = trie.Get([]byte{1})
+		assert.ErrorIs(t, err, patricia.ErrMalformedNode)
+		err = trie.Put([]byte{1}, []byte{1})
+		assert.ErrorIs(t, err, patricia.ErrMalformedNode)
+		err = trie.Delete([]byte{1})
+		assert.ErrorIs(t, err, patricia.ErrMalformedNode)
+		_, err = trie.ProofFor([]byte{1})
+		assert.ErrorIs(t, err, patricia.ErrMalformedNode)
+
+		// Update can't return errors, they're kept for Err.
+		for _, trie := range []common.MPT{
+			trie.Copy(),
+			patricia.NewSecure(trie.Copy(), nil),
+			patricia.NewConcurrent(trie.Copy()),
+		} {
+			require.NoError(t, trie.Err())
+			trie.Update([]byte{1}, []byte{1})
+			assert.ErrorIs(t, trie.Err(), patricia.ErrMalformedNode)
+			trie.Reset()
+			assert.NoError(t, trie.Err())
+		}
+	})
+}
+
+func TestMPT_Copy(t *testing.T) {
+	key := func(i int) []byte {
+		return crypto.Keccak256([]byte{byte(i)})[:3]
+	}
+
+	t.Run("copies are independent", func(t *testing.T) {
+		trie := patricia.New()
+		for i := 0; i < 100; i++ {
+			require.NoError(t, trie.Put(key(i), []byte{byte(i)}))
+		}
+		root := trie.Root()
+
+		cpy := trie.Copy()
+		require.Equal(t, root, cpy.Root())
+		for i := 0; i < 50; i++ {
+			require.NoError(t, cpy.Delete(key(i)))
+		}
+		for i := 50; i < 100; i++ {
+			require.NoError(t, cpy.Put(key(i), []byte("changed")))
+		}
+		for i := 100; i < 150; i++ {
+			require.NoError(t, cpy.Put(key(i), []byte{byte(i)}))
+		}
+
+		// the original is left untouched.
+		require.Equal(t, root, trie.Root())
+		for i := 0; i < 100; i++ {
+			v, err := trie.Get(key(i))
+			require.NoError(t, err)
+			require.Equal(t, []byte{byte(i)}, v)
+		}
+		_, err := trie.Get(key(120))
+		require.ErrorIs(t, err, common.ErrKeyNotFound)
+
+		// and changes to the original don't show up in the copy.
+		require.NoError(t, trie.Put(key(10), []byte("original")))
+		_, err = cpy.Get(key(10))
+		require.ErrorIs(t, err, common.ErrKeyNotFound)
+
+		expected := patricia.New()
+		for i := 50; i < 150; i++ {
+			v, err := cpy.Get(key(i))
+			require.NoError(t, err)
+			require.NoError(t, expected.Put(key(i), v))
+		}
+		require.Equal(t, expected.Root(), cpy.Root())
+	})
+
+	t.Run("copies on separate goroutines", func(t *testing.T) {
+		key := func(i int) []byte {
+			return crypto.Keccak256([]byte(fmt.Sprint(i)))
+		}
+		trie := patricia.New(patricia.WithParallelHashing(100, 4))
+		for i := 0; i < 500; i++ {
+			require.NoError(t, trie.Put(key(i), []byte{byte(i)}))
+		}
+		tries := []common.MPT{trie, trie.Copy(), trie.Copy()}
+
+		// every trie changes different keys, and proves a key that
+		// changed and one that didn't.
+		var wg sync.WaitGroup
+		roots := make([][]byte, len(tries))
+		values := make([][][]byte, len(tries))
+		errs := make([]error, len(tries))
+		for i, trie := range tries {
+			wg.Add(1)
+			go func(i int, trie common.MPT) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if errs[i] = trie.Put(key(i*100+j), []byte{byte(i)}); errs[i] != nil {
+						return
+					}
+				}
+				roots[i] = trie.Root()
+				for _, k := range [][]byte{key(i * 100), key(499)} {
+					proof, err := trie.ProofFor(k)
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					value, err := patricia.VerifyProof(roots[i], k, proof)
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					values[i] = append(values[i], value)
+				}
+			}(i, trie)
+		}
+		wg.Wait()
+
+		for i := range tries {
+			require.NoError(t, errs[i])
+			require.Equal(t, [][]byte{{byte(i)}, {byte(499 % 256)}}, values[i])
+
+			expected := patricia.New()
+			for j := 0; j < 500; j++ {
+				require.NoError(t, expected.Put(key(j), []byte{byte(j)}))
+			}
+			for j := 0; j < 100; j++ {
+				require.NoError(t, expected.Put(key(i*100+j), []byte{byte(i)}))
+			}
+			require.Equal(t, expected.Root(), roots[i])
+		}
+	})
+
+	t.Run("persisted trie", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, trie.Put(key(i), []byte{byte(i)}))
+		}
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+
+		cpy := trie.Copy()
+		require.NoError(t, cpy.Put(key(200), []byte("new")))
+		require.NoError(t, cpy.Delete(key(0)))
+		newRoot, err := cpy.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		require.NotEqual(t, root, newRoot)
+
+		// both versions can still be read from the database.
+		require.Equal(t, root, trie.Root())
+		_, err = trie.Get(key(200))
+		require.ErrorIs(t, err, common.ErrKeyNotFound)
+		old, err := patricia.Open(root, db)
+		require.NoError(t, err)
+		v, err := old.Get(key(0))
+		require.NoError(t, err)
+		require.Equal(t, []byte{0}, v)
+	})
+}
+
+func TestMPT_ParallelHashing(t *testing.T) {
+	key := func(i int) []byte {
+		return crypto.Keccak256([]byte(fmt.Sprint(i)))
+	}
+
+	for _, opt := range []struct {
+		threshold, concurrency int
+	}{{0, 0}, {1, 1}, {100, 4}, {100000, 4}} {
+		t.Run(fmt.Sprintf("threshold %d, concurrency %d", opt.threshold, opt.concurrency), func(t *testing.T) {
+			sequential := patricia.New()
+			parallel := patricia.New(patricia.WithParallelHashing(opt.threshold, opt.concurrency))
+			require.Equal(t, sequential.Root(), parallel.Root())
+			for i := 0; i < 2000; i++ {
+				require.NoError(t, sequential.Put(key(i), key(i+1)))
+				require.NoError(t, parallel.Put(key(i), key(i+1)))
+			}
+			require.Equal(t, sequential.Root(), parallel.Root())
+
+			// a handful of changes, which may be below the threshold.
+			for i := 0; i < 10; i++ {
+				require.NoError(t, sequential.Delete(key(i)))
+				require.NoError(t, parallel.Delete(key(i)))
+			}
+			require.Equal(t, sequential.Root(), parallel.Root())
+
+			// a single key, so the root isn't a branch.
+			single := patricia.New(patricia.WithParallelHashing(opt.threshold, opt.concurrency))
+			require.NoError(t, single.Put(key(0), key(1)))
+			expected := patricia.New()
+			require.NoError(t, expected.Put(key(0), key(1)))
+			require.Equal(t, expected.Root(), single.Root())
+		})
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db, patricia.WithParallelHashing(0, 4))
+		require.NoError(t, err)
+		expected := patricia.New()
+		for i := 0; i < 500; i++ {
+			require.NoError(t, trie.Put(key(i), key(i+1)))
+			require.NoError(t, expected.Put(key(i), key(i+1)))
+		}
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		require.Equal(t, expected.Root(), root)
+	})
+}
+
+// nodeSeed commits a trie holding kvs and encodes its nodes as fuzz input,
+// root first, each prefixed by its length.
+func nodeSeed(f *testing.F, kvs map[string]string) []byte {
+	db := rawdb.NewMemoryDatabase()
+	trie, err := patricia.Open(nil, db)
+	require.NoError(f, err)
+	for k, v := range kvs {
+		require.NoError(f, trie.Put([]byte(k), []byte(v)))
+	}
+	root, err := trie.(patricia.Committer).Commit()
+	require.NoError(f, err)
+
+	enc, err := db.Get(root)
+	require.NoError(f, err)
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(enc)))
+	data = append(data, enc...)
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if !bytes.Equal(it.Key(), root) {
+			data = binary.BigEndian.AppendUint16(data, uint16(len(it.Value())))
+			data = append(data, it.Value()...)
+		}
+	}
+	return data
+}
+
+// nodesFromSeed stores the nodes encoded in data (see nodeSeed) by their
+// hashes and returns the hash of the first one.
+func nodesFromSeed(data []byte) (root []byte, db ethdb.KeyValueStore) {
+	db = rawdb.NewMemoryDatabase()
+	for len(data) >= 2 {
+		n := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if n > len(data) {
+			n = len(data)
+		}
+		h := crypto.Keccak256(data[:n])
+		if root == nil {
+			root = h
+		}
+		_ = db.Put(h, data[:n])
+		data = data[n:]
+	}
+	return root, db
+}
+
+func FuzzMPT_Open(f *testing.F) {
+	f.Add(nodeSeed(f, map[string]string{"do": "verb", "dog": "puppy", "doge": "coin", "horse": "stallion"}), []byte("dog"))
+	f.Add(nodeSeed(f, map[string]string{
+		"a value":   "that is long enough to not be embedded in its parent",
+		"a value 2": "that is long enough to not be embedded in its parent",
+		"b":         "c",
+	}), []byte("a value 3"))
+	// an extension with an empty path, and a branch without children.
+	f.Add([]byte{0x00, 0x04, 0xc3, 0x00, 0xc1, 0x80}, []byte{})
+	f.Add([]byte{0x00, 0x11, 0xd1, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80}, []byte{0x12})
+	f.Fuzz(func(t *testing.T, data, key []byte) {
+		// nodes may reference the same node many times, so the number of
+		// nodes visited grows exponentially with the size of the input.
+		if len(data) > 2048 {
+			return
+		}
+		root, db := nodesFromSeed(data)
+		if root == nil {
+			return
+		}
+		trie, err := patricia.Open(root, db)
+		require.NoError(t, err)
+
+		// the nodes may be anything, so all that's checked is that none
+		// of the operations panic.
+		_, _ = trie.Get(key)
+		_, _ = trie.ProofFor(key)
+		_, _, _, _ = trie.(patricia.RangeProver).ProveRange(key, append(key, 0xff))
+		_, _ = patricia.Stats(trie)
+		_, _ = patricia.Validate(trie)
+		_ = patricia.WriteASCII(io.Discard, trie)
+		it := patricia.NewIterator(trie, nil)
+		for it.Next() {
+		}
+		nodes := patricia.NewNodeIterator(trie, nil)
+		for nodes.Next() {
+			nodes.Hash()
+		}
+
+		updated := trie.Copy()
+		_ = updated.Put(key, []byte{1})
+		_ = updated.Delete(append(key, 0x01))
+		_ = updated.Delete(key)
+		_ = updated.Root()
+		_ = patricia.Diff(trie, updated, func(c patricia.Change) error { return nil })
+		_, _ = updated.(patricia.Committer).Commit()
+	})
+}
+
+func FuzzMPT(f *testing.F) {
+	f.Add([]byte{0x00, 0x12, 0x34, 0x04, 0x12, 0x01, 0x12, 0x34, 0x02, 0x12})
+	f.Add([]byte{0x04, 0x01, 0x08, 0x01, 0x02, 0x05, 0x01})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		trie := patricia.New()
+		gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+		expected := map[string][]byte{}
+		// every op is an op byte followed by a key of up to 2 bytes,
+		// whose length is taken from the op byte.
+		for len(ops) > 0 {
+			op, n := ops[0]%3, int(ops[0]>>2)%3
+			ops = ops[1:]
+			if n > len(ops) {
+				n = len(ops)
+			}
+			key := ops[:n]
+			ops = ops[n:]
+			switch op {
+			case 0:
+				value := append([]byte{1}, key...)
+				require.NoError(t, trie.Put(key, value))
+				require.NoError(t, gTrie.TryUpdate(key, value))
+				expected[string(key)] = value
+			case 1:
+				require.NoError(t, trie.Delete(key))
+				require.NoError(t, gTrie.TryDelete(key))
+				delete(expected, string(key))
+			case 2:
+				v, err := trie.Get(key)
+				if value, ok := expected[string(key)]; ok {
+					require.NoError(t, err)
+					require.Equal(t, value, v)
+				} else {
+					require.ErrorIs(t, err, common.ErrKeyNotFound)
+				}
+			}
+			require.Equal(t, gTrie.Hash(), trie.Hash())
+		}
+		violations, err := patricia.Validate(trie)
+		require.NoError(t, err)
+		require.Empty(t, violations)
+	})
 }
@@ -0,0 +1,95 @@
+package patricia
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// FromProof builds a partial trie with the given root from the nodes in
+// proof, e.g the result of ProofFor, ProofForKeys or a recorded witness.
+//
+// All nodes in proof that are reachable from the root are decoded, the
+// subtrees that aren't in proof are kept as references to their hashes.
+// Get, Put and Delete work as long as the nodes they need are present, and
+// return ErrMissingNode otherwise. The root of the partial trie is always
+// the root of the full trie with the same changes applied.
+//
+// Every reachable node is checked against the hash it's referenced by, so
+// FromProof fails with ErrHashMismatch if proof holds a different node under
+// that hash. Nodes in proof that aren't reachable from the root are ignored.
+func FromProof(root []byte, proof ethdb.KeyValueReader) (common.MPT, error) {
+	m := &mpt{}
+	if len(root) == 0 || bytes.Equal(root, emptyRoot) {
+		return m, nil
+	}
+	b := &proofBuilder{
+		resolve:  proofResolver(proof),
+		expanded: make(map[string]mptNode),
+	}
+	n, err := b.expand(hashNode(root))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := n.(hashNode); ok {
+		return nil, fmt.Errorf("%w: %x", ErrMissingNode, root)
+	}
+	m.root = n
+	return m, nil
+}
+
+type proofBuilder struct {
+	resolve resolver
+	// expanded holds the nodes expanded so far by hash. A proof may
+	// reference the same node many times, so it is only expanded once
+	// and shared, which is fine since nodes are never modified.
+	expanded map[string]mptNode
+}
+
+// expand returns n with all of its descendants that are in the proof
+// decoded.
+func (b *proofBuilder) expand(n mptNode) (mptNode, error) {
+	if h, ok := n.(hashNode); ok {
+		if e, ok := b.expanded[string(h)]; ok {
+			return e, nil
+		}
+		resolved, err := b.resolve(h)
+		if errors.Is(err, ErrMissingNode) {
+			// the subtree isn't part of the proof.
+			return h, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		e, err := b.expand(resolved)
+		if err != nil {
+			return nil, err
+		}
+		b.expanded[string(h)] = e
+		return e, nil
+	}
+
+	switch n := n.(type) {
+	case *extensionNode:
+		next, err := b.expand(n.next)
+		if err != nil {
+			return nil, err
+		}
+		return &extensionNode{path: n.path, next: next}, nil
+	case *branchNode:
+		expanded := &branchNode{value: n.value}
+		for i, c := range n.children {
+			child, err := b.expand(c)
+			if err != nil {
+				return nil, err
+			}
+			expanded.children[i] = child
+		}
+		return expanded, nil
+	default:
+		return n, nil
+	}
+}
@@ -0,0 +1,103 @@
+package patricia_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromProof(t *testing.T) {
+	key := func(i int) []byte {
+		return crypto.Keccak256([]byte(fmt.Sprint(i)))
+	}
+	full := patricia.New()
+	for i := 0; i < 200; i++ {
+		require.NoError(t, full.Put(key(i), key(i+1)))
+	}
+	root := full.Root()
+	proven := [][]byte{key(1), key(2), key(3), key(1000)}
+	proof, err := full.(patricia.MultiProver).ProofForKeys(proven)
+	require.NoError(t, err)
+
+	t.Run("get", func(t *testing.T) {
+		partial, err := patricia.FromProof(root, proof)
+		require.NoError(t, err)
+		require.Equal(t, root, partial.Root())
+		for _, i := range []int{1, 2, 3} {
+			v, err := partial.Get(key(i))
+			require.NoError(t, err)
+			require.Equal(t, key(i+1), v)
+		}
+		_, err = partial.Get(key(1000))
+		require.ErrorIs(t, err, common.ErrKeyNotFound)
+		_, err = partial.Get(key(100))
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("updates", func(t *testing.T) {
+		partial, err := patricia.FromProof(root, proof)
+		require.NoError(t, err)
+		expected := full.Copy()
+		for _, trie := range []common.MPT{partial, expected} {
+			require.NoError(t, trie.Put(key(1), []byte("changed")))
+			require.NoError(t, trie.Put(key(1000), []byte("added")))
+			require.NoError(t, trie.Delete(key(2)))
+		}
+		require.Equal(t, expected.Root(), partial.Root())
+
+		// paths that aren't in the proof can't be changed.
+		require.ErrorIs(t, partial.Put(key(100), []byte("changed")), patricia.ErrMissingNode)
+		require.ErrorIs(t, partial.Delete(key(100)), patricia.ErrMissingNode)
+		require.Equal(t, expected.Root(), partial.Root())
+	})
+
+	t.Run("witness", func(t *testing.T) {
+		trie := full.Copy()
+		trie.(patricia.Recorder).StartRecording()
+		require.NoError(t, trie.Put(key(50), []byte("changed")))
+		require.NoError(t, trie.Delete(key(60)))
+		witness := trie.(patricia.Recorder).StopRecording()
+
+		partial, err := patricia.FromProof(root, witness)
+		require.NoError(t, err)
+		require.NoError(t, partial.Put(key(50), []byte("changed")))
+		require.NoError(t, partial.Delete(key(60)))
+		require.Equal(t, trie.Root(), partial.Root())
+	})
+
+	t.Run("empty trie", func(t *testing.T) {
+		partial, err := patricia.FromProof(patricia.New().Root(), memorydb.New())
+		require.NoError(t, err)
+		require.NoError(t, partial.Put([]byte("key"), []byte("value")))
+		expected := patricia.New()
+		require.NoError(t, expected.Put([]byte("key"), []byte("value")))
+		require.Equal(t, expected.Root(), partial.Root())
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		_, err := patricia.FromProof(root, memorydb.New())
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("tampered proof", func(t *testing.T) {
+		tampered := memorydb.New()
+		it := proof.(ethdb.Iteratee).NewIterator(nil, nil)
+		for it.Next() {
+			value := common.Concat(it.Value(), nil)
+			if !bytes.Equal(it.Key(), root) {
+				value[len(value)-1] ^= 1
+			}
+			require.NoError(t, tampered.Put(it.Key(), value))
+		}
+		it.Release()
+		_, err := patricia.FromProof(root, tampered)
+		require.ErrorIs(t, err, patricia.ErrHashMismatch)
+	})
+}
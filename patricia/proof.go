@@ -0,0 +1,334 @@
+package patricia
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+var (
+	// ErrHashMismatch is returned when a proof node doesn't hash
+	// to the hash it is referenced by.
+	ErrHashMismatch = fmt.Errorf("trie node hash mismatch")
+	// ErrInvalidRange is returned for range proofs whose bounds, keys
+	// or values are inconsistent.
+	ErrInvalidRange = fmt.Errorf("invalid range")
+)
+
+// VerifyProof checks a merkle proof for key, as constructed by ProofFor,
+// against the given root hash and returns the value stored under key.
+//
+// The proof is walked from the root down, following the path of key
+// through branch, extension and leaf nodes. Every node that is looked up
+// in the proof is checked against the hash it is referenced by, so a proof
+// can only verify if it was built from a trie with the given root.
+//
+// If the proof shows that key is not in the trie, a nil value and a nil
+// error are returned, in line with the semantics of eth_getProof.
+func VerifyProof(root, key []byte, proof ethdb.KeyValueReader) (value []byte, err error) {
+	// the empty trie proves the absence of every key.
+	if bytes.Equal(root, emptyRoot) {
+		return nil, nil
+	}
+	value, err = get(hashNode(root), common.BytesToNibbles(key), proofResolver(proof))
+	if errors.Is(err, common.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// VerifyMultiProof checks a merkle proof for multiple keys, as constructed by
+// ProofForKeys, against the given root hash and returns the values stored
+// under the keys, in the same order. Absent keys have a nil value, as in
+// VerifyProof.
+// Every node in the proof is decoded and checked against its hash only once,
+// no matter how many of the keys share it.
+func VerifyMultiProof(root []byte, keys [][]byte, proof ethdb.KeyValueReader) (values [][]byte, err error) {
+	values = make([][]byte, len(keys))
+	if bytes.Equal(root, emptyRoot) {
+		return values, nil
+	}
+	resolve := memoizingResolver(proofResolver(proof))
+	for i, key := range keys {
+		value, err := get(hashNode(root), common.BytesToNibbles(key), resolve)
+		if errors.Is(err, common.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %x: %w", key, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// proofFromNodes stores the given proof nodes by their hashes, for VerifyProof.
+func proofFromNodes(nodes []hexutil.Bytes) *memorydb.Database {
+	db := memorydb.New()
+	for _, n := range nodes {
+		// a memorydb never fails to write.
+		_ = db.Put(crypto.Keccak256(n), n)
+	}
+	return db
+}
+
+// memoizingResolver returns a resolver that only calls resolve once for
+// every hash.
+func memoizingResolver(resolve resolver) resolver {
+	resolved := make(map[string]mptNode)
+	return func(h hashNode) (mptNode, error) {
+		if n, ok := resolved[string(h)]; ok {
+			return n, nil
+		}
+		n, err := resolve(h)
+		if err != nil {
+			return nil, err
+		}
+		resolved[string(h)] = n
+		return n, nil
+	}
+}
+
+// proofResolver returns a resolver that loads nodes from the given proof,
+// checking that each node hashes to its reference.
+func proofResolver(proof ethdb.KeyValueReader) resolver {
+	return func(h hashNode) (mptNode, error) {
+		enc, err := proof.Get(h)
+		if err != nil || len(enc) == 0 {
+			return nil, fmt.Errorf("%w: %x", ErrMissingNode, []byte(h))
+		}
+		if !bytes.Equal(crypto.Keccak256(enc), h) {
+			return nil, fmt.Errorf("%w: %x", ErrHashMismatch, []byte(h))
+		}
+		return decodeNode(enc)
+	}
+}
+
+// ProveRange returns all key-value pairs in the trie whose keys are within
+// [first, last], in order, along with a proof that no other keys in that
+// interval exist. The proof consists of the proofs for first and last,
+// see VerifyRangeProof.
+func (m *mpt) ProveRange(first, last []byte) (keys, values [][]byte, proof ethdb.KeyValueReader, err error) {
+	if bytes.Compare(first, last) > 0 {
+		return nil, nil, nil, fmt.Errorf("%w: first key %x is after last key %x", ErrInvalidRange, first, last)
+	}
+
+	b := &bounds{common.BytesToNibbles(first), common.BytesToNibbles(last)}
+	it := &Iterator{nodes: newNodeIterator(m, b.left, nil)}
+	for it.Next() && bytes.Compare(it.Key(), last) <= 0 {
+		keys = append(keys, it.Key())
+		values = append(values, it.Value())
+	}
+	if it.Err() != nil {
+		return nil, nil, nil, it.Err()
+	}
+
+	proofDB := rawdb.NewMemoryDatabase()
+	if err := m.prove(b.left, proofDB); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := m.prove(b.right, proofDB); err != nil {
+		return nil, nil, nil, err
+	}
+	return keys, values, proofDB, nil
+}
+
+// VerifyRangeProof checks that keys and values are exactly the key-value
+// pairs stored in the trie with the given root whose keys are within
+// [first, last], i.e that none are missing, altered or made up.
+// keys must be sorted in ascending order.
+//
+// proof must contain the proofs for first and last, as returned by
+// ProveRange. The trie is rebuilt from the nodes on those two paths, with
+// everything in between replaced by keys and values, and its root is
+// compared to the given one.
+//
+// A nil proof asserts that keys and values make up the entire trie.
+func VerifyRangeProof(root, first, last []byte, keys, values [][]byte, proof ethdb.KeyValueReader) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("%w: %d keys but %d values", ErrInvalidRange, len(keys), len(values))
+	}
+	if bytes.Compare(first, last) > 0 {
+		return fmt.Errorf("%w: first key %x is after last key %x", ErrInvalidRange, first, last)
+	}
+	for i, key := range keys {
+		if i > 0 && bytes.Compare(keys[i-1], key) >= 0 {
+			return fmt.Errorf("%w: keys out of order at index %d", ErrInvalidRange, i)
+		}
+		if bytes.Compare(key, first) < 0 || bytes.Compare(key, last) > 0 {
+			return fmt.Errorf("%w: key %x out of bounds", ErrInvalidRange, key)
+		}
+		if len(values[i]) == 0 {
+			return fmt.Errorf("%w: empty value for key %x", ErrInvalidRange, key)
+		}
+	}
+
+	m := &mpt{}
+	if proof != nil && !bytes.Equal(root, emptyRoot) {
+		b := &bounds{common.BytesToNibbles(first), common.BytesToNibbles(last)}
+		resolve := proofResolver(proof)
+
+		// materialize the paths of both bounds, then drop everything
+		// in between. What remains lies outside of the range.
+		n, err := expand(hashNode(root), b.left, resolve)
+		if err != nil {
+			return err
+		}
+		n, err = expand(n, b.right, resolve)
+		if err != nil {
+			return err
+		}
+		m.root, err = prune(n, nil, b)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, key := range keys {
+		if err := m.Put(key, values[i]); err != nil {
+			return err
+		}
+	}
+	actual, err := m.rootHash()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(actual, root) {
+		return fmt.Errorf("%w: range proof root %x, expected %x", ErrHashMismatch, actual, root)
+	}
+	return nil
+}
+
+// expand returns n with all nodes on the path of nibbles loaded using
+// resolve. Nodes on that path are copied, the rest of the trie is shared.
+func expand(n mptNode, nibbles []byte, resolve resolver) (mptNode, error) {
+	if h, ok := n.(hashNode); ok {
+		resolved, err := resolve(h)
+		if err != nil {
+			return nil, err
+		}
+		n = resolved
+	}
+	switch n := n.(type) {
+	case *extensionNode:
+		if !common.HasPrefix(nibbles, n.path) {
+			return n, nil
+		}
+		next, err := expand(n.next, nibbles[len(n.path):], resolve)
+		if err != nil {
+			return nil, err
+		}
+		return &extensionNode{path: n.path, next: next}, nil
+	case *branchNode:
+		if len(nibbles) == 0 {
+			return n, nil
+		}
+		child, err := expand(n.children[nibbles[0]], nibbles[1:], resolve)
+		if err != nil {
+			return nil, err
+		}
+		b := &branchNode{children: n.children, value: n.value}
+		b.children[nibbles[0]] = child
+		return b, nil
+	default:
+		return n, nil
+	}
+}
+
+// prune removes all keys within b from the subtree rooted at n, whose path
+// from the root is prefix. Subtrees that straddle one of the bounds must
+// be loaded, see expand.
+// The result is not necessarily a well-formed trie, e.g a branch may be left
+// with a single child, until the removed keys are inserted again.
+func prune(n mptNode, prefix []byte, b *bounds) (mptNode, error) {
+	if n == nil {
+		return nil, nil
+	}
+	switch b.classify(prefix) {
+	case inside:
+		return nil, nil
+	case outside:
+		return n, nil
+	}
+
+	switch n := n.(type) {
+	case hashNode:
+		return nil, fmt.Errorf("%w: range proof is missing node %x", ErrMissingNode, []byte(n))
+	case *leafNode:
+		if b.contains(common.Concat(prefix, n.path)) {
+			return nil, nil
+		}
+		return n, nil
+	case *extensionNode:
+		next, err := prune(n.next, common.Concat(prefix, n.path), b)
+		if err != nil || next == nil {
+			return nil, err
+		}
+		return &extensionNode{path: n.path, next: next}, nil
+	case *branchNode:
+		pruned := &branchNode{value: n.value}
+		if b.contains(prefix) {
+			pruned.value = nil
+		}
+		empty := pruned.value == nil
+		for i, c := range n.children {
+			child, err := prune(c, common.Concat(prefix, []byte{byte(i)}), b)
+			if err != nil {
+				return nil, err
+			}
+			pruned.children[i] = child
+			empty = empty && child == nil
+		}
+		if empty {
+			return nil, nil
+		}
+		return pruned, nil
+	default:
+		return n, nil
+	}
+}
+
+// bounds is an inclusive interval of nibble paths.
+type bounds struct {
+	left, right []byte
+}
+
+const (
+	inside = iota
+	outside
+	straddling
+)
+
+// classify reports whether all keys under prefix are inside the bounds,
+// all of them are outside, or neither.
+func (b *bounds) classify(prefix []byte) int {
+	var (
+		// prefix is the smallest key in the subtree, so it's enough to
+		// compare it against the left bound.
+		allAfterLeft = bytes.Compare(prefix, b.left) >= 0
+		// the subtree contains keys after the right bound unless prefix
+		// sorts before it and isn't a prefix of it.
+		allBeforeRight = bytes.Compare(prefix, b.right) < 0 && !common.HasPrefix(b.right, prefix)
+	)
+	switch {
+	case allAfterLeft && allBeforeRight:
+		return inside
+	case bytes.Compare(prefix, b.left) < 0 && !common.HasPrefix(b.left, prefix),
+		bytes.Compare(prefix, b.right) > 0:
+		return outside
+	default:
+		return straddling
+	}
+}
+
+// contains reports whether key is within the bounds.
+func (b *bounds) contains(key []byte) bool {
+	return bytes.Compare(key, b.left) >= 0 && bytes.Compare(key, b.right) <= 0
+}
@@ -0,0 +1,475 @@
+package patricia_test
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	gethTrie "github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyProof(t *testing.T) {
+	kvs := []struct {
+		key, value []byte
+	}{
+		{[]byte{1, 2, 3, 4}, []byte("hello")},
+		{[]byte{1, 2, 5, 4}, []byte("world")},
+		{[]byte{1, 2, 6, 4}, []byte("haha")},
+		{[]byte{1, 7, 3, 4}, []byte("yessir")},
+		{[]byte{9, 2, 3, 4}, []byte("tweet it")},
+		{crypto.Keccak256([]byte("long")), crypto.Keccak256([]byte("value"))},
+	}
+
+	t.Run("own proofs", func(t *testing.T) {
+		trie := patricia.New()
+		for _, kv := range kvs {
+			require.NoError(t, trie.Put(kv.key, kv.value))
+		}
+		for _, kv := range kvs {
+			proof, err := trie.ProofFor(kv.key)
+			require.NoError(t, err)
+			val, err := patricia.VerifyProof(trie.Root(), kv.key, proof)
+			require.NoError(t, err)
+			assert.Equal(t, kv.value, val)
+		}
+	})
+
+	t.Run("geth proofs", func(t *testing.T) {
+		gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+		for _, kv := range kvs {
+			gTrie.Update(kv.key, kv.value)
+		}
+		for _, kv := range kvs {
+			proof := memorydb.New()
+			require.NoError(t, gTrie.Prove(kv.key, 0, proof))
+			val, err := patricia.VerifyProof(gTrie.Hash().Bytes(), kv.key, proof)
+			require.NoError(t, err)
+			assert.Equal(t, kv.value, val)
+		}
+	})
+
+	t.Run("transactions trie", func(t *testing.T) {
+		header := headerFromJSON(t, "testdata/16614538/header.json")
+		txs := transactionsFromJSON(t, "testdata/16614538/txs.json")
+		trie := patricia.New()
+		for i := range txs {
+			key, err := rlp.EncodeToBytes(uint64(i))
+			require.NoError(t, err)
+			val, err := txs[i].MarshalBinary()
+			require.NoError(t, err)
+			require.NoError(t, trie.Put(key, val))
+		}
+		require.Equal(t, header.TxHash.Bytes(), trie.Root())
+
+		key, err := rlp.EncodeToBytes(uint64(17))
+		require.NoError(t, err)
+		proof, err := trie.ProofFor(key)
+		require.NoError(t, err)
+		val, err := patricia.VerifyProof(header.TxHash.Bytes(), key, proof)
+		require.NoError(t, err)
+		expected, err := txs[17].MarshalBinary()
+		require.NoError(t, err)
+		assert.Equal(t, expected, val)
+	})
+
+	t.Run("missing node", func(t *testing.T) {
+		trie := patricia.New()
+		for _, kv := range kvs {
+			require.NoError(t, trie.Put(kv.key, kv.value))
+		}
+		_, err := patricia.VerifyProof(trie.Root(), kvs[0].key, memorydb.New())
+		assert.ErrorIs(t, err, patricia.ErrMissingNode)
+
+		// a proof for a different trie doesn't verify either.
+		other := patricia.New()
+		require.NoError(t, other.Put(kvs[0].key, kvs[0].value))
+		proof, err := other.ProofFor(kvs[0].key)
+		require.NoError(t, err)
+		_, err = patricia.VerifyProof(trie.Root(), kvs[0].key, proof)
+		assert.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		trie := patricia.New()
+		for _, kv := range kvs {
+			require.NoError(t, trie.Put(kv.key, kv.value))
+		}
+		proof := memorydb.New()
+		require.NoError(t, proof.Put(trie.Root(), []byte{0xc2, 0x80, 0x80}))
+		_, err := patricia.VerifyProof(trie.Root(), kvs[0].key, proof)
+		assert.ErrorIs(t, err, patricia.ErrHashMismatch)
+	})
+
+	t.Run("malformed node", func(t *testing.T) {
+		for _, enc := range [][]byte{
+			{0xc3, 0x80, 0x80, 0x80},       // 3-item list
+			{0x83, 0x01, 0x02, 0x03},       // non-empty string
+			{0xc2, 0x80, 0x80},             // empty compact path
+			{0xc3, 0x81, 0x40, 0x80},       // unknown compact flag
+			{0xc4, 0x81, 0x00, 0x81, 0x01}, // extension with invalid child reference
+			{0xc4, 0x81, 0x20, 0x80, 0x80}, // trailing elements
+			{0xc2, 0x80},                   // truncated
+		} {
+			proof := memorydb.New()
+			root := crypto.Keccak256(enc)
+			require.NoError(t, proof.Put(root, enc))
+			_, err := patricia.VerifyProof(root, []byte{1}, proof)
+			assert.ErrorIs(t, err, patricia.ErrMalformedNode, "encoding %x", enc)
+		}
+	})
+
+}
+
+func TestVerifyProof_Absence(t *testing.T) {
+	trie := patricia.New()
+	gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+	for _, kv := range []struct {
+		key, value []byte
+	}{
+		{[]byte{0x12, 0x34}, []byte("hello")},
+		{[]byte{0x12, 0x35}, []byte("world")},
+		{[]byte{0x12, 0x35, 0x01}, []byte("longer")},
+		{[]byte{0x56, 0x78, 0x9a}, []byte("extension")},
+		{[]byte{0x56, 0x78, 0x9b}, []byte("extension too")},
+		{[]byte{0xab, 0xcd}, []byte("leaf")},
+	} {
+		require.NoError(t, trie.Put(kv.key, kv.value))
+		gTrie.Update(kv.key, kv.value)
+	}
+	require.Equal(t, gTrie.Hash().Bytes(), trie.Root())
+
+	for _, tc := range []struct {
+		name string
+		key  []byte
+	}{
+		{"empty branch slot", []byte{0x34}},
+		{"mismatching extension", []byte{0x56, 0x77}},
+		{"different leaf", []byte{0xab, 0xce}},
+		{"key ends at branch without value", []byte{0x12}},
+		{"key ends in extension", []byte{0x56}},
+		{"key longer than leaf", []byte{0xab, 0xcd, 0xef}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			proof, err := trie.ProofFor(tc.key)
+			require.NoError(t, err)
+			val, err := patricia.VerifyProof(trie.Root(), tc.key, proof)
+			require.NoError(t, err)
+			assert.Nil(t, val)
+
+			// geth agrees on the absence.
+			val, err = gethTrie.VerifyProof(gTrie.Hash(), tc.key, proof)
+			require.NoError(t, err)
+			assert.Nil(t, val)
+
+			// and the proof doesn't verify against another root.
+			_, err = patricia.VerifyProof(crypto.Keccak256([]byte("other")), tc.key, proof)
+			assert.ErrorIs(t, err, patricia.ErrMissingNode)
+		})
+	}
+
+	t.Run("empty trie", func(t *testing.T) {
+		empty := patricia.New()
+		proof, err := empty.ProofFor([]byte{1, 2, 3})
+		require.NoError(t, err)
+		val, err := patricia.VerifyProof(empty.Root(), []byte{1, 2, 3}, proof)
+		require.NoError(t, err)
+		assert.Nil(t, val)
+	})
+}
+
+func TestVerifyRangeProof(t *testing.T) {
+	trie := patricia.New()
+	gTrie := gethTrie.NewEmpty(gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+	var keys [][]byte
+	for i := 0; i < 500; i++ {
+		key := crypto.Keccak256([]byte{byte(i), byte(i >> 8)})
+		require.NoError(t, trie.Put(key, []byte(fmt.Sprintf("value-%d", i))))
+		gTrie.Update(key, []byte(fmt.Sprintf("value-%d", i)))
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	root := trie.Root()
+	require.Equal(t, gTrie.Hash().Bytes(), root)
+
+	t.Run("existing bounds", func(t *testing.T) {
+		for _, r := range [][2]int{{0, 0}, {0, 499}, {10, 20}, {100, 101}, {250, 499}, {498, 499}} {
+			first, last := keys[r[0]], keys[r[1]]
+			ks, vs, proof, err := trie.(patricia.RangeProver).ProveRange(first, last)
+			require.NoError(t, err)
+			require.Equal(t, keys[r[0]:r[1]+1], ks)
+			require.NoError(t, patricia.VerifyRangeProof(root, first, last, ks, vs, proof))
+
+			_, err = gethTrie.VerifyRangeProof(gTrie.Hash(), first, last, ks, vs, proof)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("absent bounds", func(t *testing.T) {
+		first, last := increment(keys[41]), decrement(keys[77])
+		ks, vs, proof, err := trie.(patricia.RangeProver).ProveRange(first, last)
+		require.NoError(t, err)
+		require.Equal(t, keys[42:77], ks)
+		require.NoError(t, patricia.VerifyRangeProof(root, first, last, ks, vs, proof))
+
+		// geth's proofs are accepted as well.
+		gProof := memorydb.New()
+		require.NoError(t, gTrie.Prove(first, 0, gProof))
+		require.NoError(t, gTrie.Prove(last, 0, gProof))
+		require.NoError(t, patricia.VerifyRangeProof(root, first, last, ks, vs, gProof))
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		first, last := increment(keys[41]), decrement(keys[42])
+		ks, vs, proof, err := trie.(patricia.RangeProver).ProveRange(first, last)
+		require.NoError(t, err)
+		require.Empty(t, ks)
+		require.NoError(t, patricia.VerifyRangeProof(root, first, last, ks, vs, proof))
+
+		// a key that does exist can't be hidden.
+		first, last = increment(keys[41]), increment(keys[42])
+		_, _, proof, err = trie.(patricia.RangeProver).ProveRange(first, last)
+		require.NoError(t, err)
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, first, last, nil, nil, proof), patricia.ErrHashMismatch)
+	})
+
+	t.Run("paging", func(t *testing.T) {
+		var (
+			all   [][]byte
+			first = []byte{0x00}
+		)
+		for _, last := range [][]byte{{0x3f, 0xff}, {0x7f, 0xff}, {0xbf, 0xff}, bytes.Repeat([]byte{0xff}, 33)} {
+			ks, vs, proof, err := trie.(patricia.RangeProver).ProveRange(first, last)
+			require.NoError(t, err)
+			require.NoError(t, patricia.VerifyRangeProof(root, first, last, ks, vs, proof))
+			all = append(all, ks...)
+			first = increment(last)
+		}
+		assert.Equal(t, keys, all)
+	})
+
+	t.Run("whole trie without proof", func(t *testing.T) {
+		ks, vs, _, err := trie.(patricia.RangeProver).ProveRange(nil, bytes.Repeat([]byte{0xff}, 32))
+		require.NoError(t, err)
+		require.NoError(t, patricia.VerifyRangeProof(root, nil, bytes.Repeat([]byte{0xff}, 32), ks, vs, nil))
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, nil, bytes.Repeat([]byte{0xff}, 32), ks[1:], vs[1:], nil), patricia.ErrHashMismatch)
+	})
+
+	t.Run("tampered ranges", func(t *testing.T) {
+		first, last := keys[100], keys[200]
+		ks, vs, proof, err := trie.(patricia.RangeProver).ProveRange(first, last)
+		require.NoError(t, err)
+
+		// missing key in the middle and at the edges.
+		for _, i := range []int{0, 50, len(ks) - 1} {
+			gapKeys := append(append([][]byte{}, ks[:i]...), ks[i+1:]...)
+			gapValues := append(append([][]byte{}, vs[:i]...), vs[i+1:]...)
+			assert.ErrorIs(t, patricia.VerifyRangeProof(root, first, last, gapKeys, gapValues, proof), patricia.ErrHashMismatch)
+		}
+
+		// altered value.
+		altered := append([][]byte{}, vs...)
+		altered[10] = []byte("altered")
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, first, last, ks, altered, proof), patricia.ErrHashMismatch)
+
+		// made up key.
+		extraKeys := append([][]byte{}, ks[:10]...)
+		extraKeys = append(extraKeys, increment(ks[9]))
+		extraKeys = append(extraKeys, ks[10:]...)
+		extraValues := append([][]byte{}, vs[:10]...)
+		extraValues = append(extraValues, []byte("extra"))
+		extraValues = append(extraValues, vs[10:]...)
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, first, last, extraKeys, extraValues, proof), patricia.ErrHashMismatch)
+
+		// malformed inputs.
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, first, last, ks, vs[1:], proof), patricia.ErrInvalidRange)
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, last, first, ks, vs, proof), patricia.ErrInvalidRange)
+		swapped := append([][]byte{}, ks...)
+		swapped[1], swapped[2] = swapped[2], swapped[1]
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, first, last, swapped, vs, proof), patricia.ErrInvalidRange)
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, first, keys[150], ks, vs, proof), patricia.ErrInvalidRange)
+
+		// proof for different bounds.
+		_, _, otherProof, err := trie.(patricia.RangeProver).ProveRange(keys[300], keys[400])
+		require.NoError(t, err)
+		assert.ErrorIs(t, patricia.VerifyRangeProof(root, first, last, ks, vs, otherProof), patricia.ErrMissingNode)
+	})
+
+	t.Run("variable length keys", func(t *testing.T) {
+		trie := patricia.New()
+		for _, key := range []string{"a", "ab", "abc", "abd", "b", "ba", "bac", "c"} {
+			require.NoError(t, trie.Put([]byte(key), []byte("value-"+key)))
+		}
+		first, last := []byte("ab"), []byte("bac")
+		ks, vs, proof, err := trie.(patricia.RangeProver).ProveRange(first, last)
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("ab"), []byte("abc"), []byte("abd"), []byte("b"), []byte("ba"), []byte("bac")}, ks)
+		require.NoError(t, patricia.VerifyRangeProof(trie.Root(), first, last, ks, vs, proof))
+		assert.Error(t, patricia.VerifyRangeProof(trie.Root(), first, last, ks[1:], vs[1:], proof))
+		assert.Error(t, patricia.VerifyRangeProof(trie.Root(), first, last, ks[:5], vs[:5], proof))
+	})
+}
+
+// increment returns the smallest key of the same length greater than key.
+func increment(key []byte) []byte {
+	r := append([]byte{}, key...)
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i]++
+		if r[i] != 0 {
+			break
+		}
+	}
+	return r
+}
+
+// decrement returns the largest key of the same length smaller than key.
+func decrement(key []byte) []byte {
+	r := append([]byte{}, key...)
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i]--
+		if r[i] != 0xff {
+			break
+		}
+	}
+	return r
+}
+
+// proofSize returns the number of nodes and the total size of a proof.
+func proofSize(t *testing.T, proof ethdb.KeyValueReader) (nodes, size int) {
+	it := proof.(ethdb.Iteratee).NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		nodes++
+		size += len(it.Value())
+	}
+	require.NoError(t, it.Error())
+	return
+}
+
+func TestVerifyMultiProof(t *testing.T) {
+	receipts := receiptsFromJSON(t, "testdata/16614538/receipts.json")
+	header := headerFromJSON(t, "testdata/16614538/header.json")
+	trie := patricia.New()
+	types.DeriveSha(receipts, trie)
+	root := header.ReceiptHash.Bytes()
+	require.Equal(t, root, trie.Root())
+
+	var keys, expected [][]byte
+	for i := range receipts {
+		key, err := rlp.EncodeToBytes(uint64(i))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		receipts.EncodeIndex(i, &buf)
+		keys = append(keys, key)
+		expected = append(expected, buf.Bytes())
+	}
+
+	t.Run("all receipts", func(t *testing.T) {
+		proof, err := trie.(patricia.MultiProver).ProofForKeys(keys)
+		require.NoError(t, err)
+		values, err := patricia.VerifyMultiProof(root, keys, proof)
+		require.NoError(t, err)
+		require.Equal(t, expected, values)
+
+		// the multiproof is much smaller than the individual proofs.
+		var separateNodes, separateSize int
+		for _, key := range keys {
+			keyProof, err := trie.ProofFor(key)
+			require.NoError(t, err)
+			nodes, size := proofSize(t, keyProof)
+			separateNodes += nodes
+			separateSize += size
+		}
+		nodes, size := proofSize(t, proof)
+		require.Less(t, nodes, separateNodes)
+		require.Less(t, size, separateSize)
+		t.Logf("%d keys: %d nodes, %d bytes (separately %d nodes, %d bytes)", len(keys), nodes, size, separateNodes, separateSize)
+	})
+
+	t.Run("present and absent keys", func(t *testing.T) {
+		absent, err := rlp.EncodeToBytes(uint64(len(receipts) + 1))
+		require.NoError(t, err)
+		proofKeys := [][]byte{keys[3], absent, keys[len(keys)-1]}
+		proof, err := trie.(patricia.MultiProver).ProofForKeys(proofKeys)
+		require.NoError(t, err)
+		values, err := patricia.VerifyMultiProof(root, proofKeys, proof)
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{expected[3], nil, expected[len(keys)-1]}, values)
+	})
+
+	t.Run("key missing from the proof", func(t *testing.T) {
+		proof, err := trie.(patricia.MultiProver).ProofForKeys(keys[:2])
+		require.NoError(t, err)
+		_, err = patricia.VerifyMultiProof(root, keys[:3], proof)
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+	})
+
+	t.Run("tampered proof", func(t *testing.T) {
+		proof, err := trie.(patricia.MultiProver).ProofForKeys(keys[:2])
+		require.NoError(t, err)
+		tampered := memorydb.New()
+		it := proof.(ethdb.Iteratee).NewIterator(nil, nil)
+		for it.Next() {
+			value := common.CopyBytes(it.Value())
+			if bytes.Equal(it.Key(), root) {
+				value[len(value)-1] ^= 1
+			}
+			require.NoError(t, tampered.Put(it.Key(), value))
+		}
+		it.Release()
+		_, err = patricia.VerifyMultiProof(root, keys[:2], tampered)
+		require.ErrorIs(t, err, patricia.ErrHashMismatch)
+	})
+
+	t.Run("empty trie", func(t *testing.T) {
+		empty := patricia.New()
+		proof, err := empty.(patricia.MultiProver).ProofForKeys(keys[:2])
+		require.NoError(t, err)
+		values, err := patricia.VerifyMultiProof(empty.Root(), keys[:2], proof)
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{nil, nil}, values)
+	})
+}
+
+func FuzzVerifyProof(f *testing.F) {
+	f.Add(nodeSeed(f, map[string]string{"do": "verb", "dog": "puppy", "doge": "coin", "horse": "stallion"}), []byte("doge"))
+	f.Add(nodeSeed(f, map[string]string{
+		"a value":   "that is long enough to not be embedded in its parent",
+		"a value 2": "that is long enough to not be embedded in its parent",
+	}), []byte("a value 2"))
+	f.Fuzz(func(t *testing.T, data, key []byte) {
+		if len(data) > 2048 {
+			return
+		}
+		root, proof := nodesFromSeed(data)
+		if root == nil {
+			return
+		}
+
+		// a proof may be anything, it's only checked that verifying it
+		// doesn't panic.
+		_, _ = patricia.VerifyProof(root, key, proof)
+		_, _ = patricia.VerifyMultiProof(root, [][]byte{key, append(key, 0x01)}, proof)
+		_ = patricia.VerifyRangeProof(root, key, append(key, 0xff), [][]byte{key}, [][]byte{{1}}, proof)
+		_ = patricia.VerifyRangeProof(root, key, append(key, 0xff), nil, nil, proof)
+
+		partial, err := patricia.FromProof(root, proof)
+		if err != nil {
+			return
+		}
+		_, _ = partial.Get(key)
+		_ = partial.Put(key, []byte{1})
+		_ = partial.Delete(append(key, 0x01))
+		_ = partial.Root()
+	})
+}
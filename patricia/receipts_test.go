@@ -13,7 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func receiptsFromJSON(t *testing.T, receiptsJSONPath string) (r types.Receipts) {
+func receiptsFromJSON(t testing.TB, receiptsJSONPath string) (r types.Receipts) {
 	f, err := os.Open(receiptsJSONPath)
 	require.NoError(t, err)
 	defer f.Close()
@@ -0,0 +1,178 @@
+package patricia
+
+import (
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	gethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+var (
+	// ErrMissingPreimage is returned by GetKey when the original key of a
+	// hashed key isn't known.
+	ErrMissingPreimage = fmt.Errorf("missing preimage")
+)
+
+// PreimageStore stores the original keys of a secure trie, keyed by
+// their hash. Any ethdb.KeyValueStore, e.g rawdb.NewMemoryDatabase(),
+// can be used.
+type PreimageStore interface {
+	ethdb.KeyValueReader
+	ethdb.KeyValueWriter
+}
+
+// secureMPT is an MPT where the path of every key is keccak256(key) rather
+// than the key itself. This is how the state and storage tries in ethereum
+// are keyed, and it keeps the trie balanced no matter what the keys are.
+type secureMPT struct {
+	trie common.MPT
+	// preimages is where the original keys are recorded, it may be nil.
+	preimages PreimageStore
+	// err is the first error Update ran into, see Err.
+	err error
+}
+
+var _ common.SecureMPT = &secureMPT{}
+
+// NewSecure wraps trie so that keys are hashed with keccak256 before they're
+// used as paths. If preimages isn't nil, the original key of every key that
+// is put into the trie is recorded in it, see GetKey.
+//
+// Get, Put and Delete take original keys, while ProofFor, ProveRange and
+// the iterators work on the hashed keys, i.e on the actual trie paths.
+func NewSecure(trie common.MPT, preimages PreimageStore) common.SecureMPT {
+	return &secureMPT{
+		trie:      trie,
+		preimages: preimages,
+	}
+}
+
+// Get implements MPT
+func (s *secureMPT) Get(key []byte) (value []byte, err error) {
+	return s.trie.Get(crypto.Keccak256(key))
+}
+
+// Put implements MPT
+func (s *secureMPT) Put(key, value []byte) error {
+	hashed := crypto.Keccak256(key)
+	if s.preimages != nil {
+		if err := s.preimages.Put(hashed, gethCommon.CopyBytes(key)); err != nil {
+			return err
+		}
+	}
+	return s.trie.Put(hashed, value)
+}
+
+// Delete implements MPT
+func (s *secureMPT) Delete(key []byte) error {
+	return s.trie.Delete(crypto.Keccak256(key))
+}
+
+// GetKey implements SecureMPT
+func (s *secureMPT) GetKey(hashedKey []byte) (key []byte, err error) {
+	if s.preimages == nil {
+		return nil, fmt.Errorf("%w: %x", ErrMissingPreimage, hashedKey)
+	}
+	key, err = s.preimages.Get(hashedKey)
+	if err != nil || key == nil {
+		return nil, fmt.Errorf("%w: %x", ErrMissingPreimage, hashedKey)
+	}
+	return key, nil
+}
+
+// Root implements MPT
+func (s *secureMPT) Root() []byte {
+	return s.trie.Root()
+}
+
+// ProofFor implements MPT
+// hashedKey is the path of the key in the trie, i.e keccak256(key).
+func (s *secureMPT) ProofFor(hashedKey []byte) (ethdb.KeyValueReader, error) {
+	return s.trie.ProofFor(hashedKey)
+}
+
+// ProofForKeys implements MultiProver
+// hashedKeys are the paths of the keys in the trie.
+func (s *secureMPT) ProofForKeys(hashedKeys [][]byte) (ethdb.KeyValueReader, error) {
+	p, ok := s.trie.(MultiProver)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T can't prove several keys", ErrUnsupported, s.trie)
+	}
+	return p.ProofForKeys(hashedKeys)
+}
+
+// ProveRange implements RangeProver
+// The bounds and the returned keys are hashed keys.
+func (s *secureMPT) ProveRange(first, last []byte) (keys, values [][]byte, proof ethdb.KeyValueReader, err error) {
+	p, ok := s.trie.(RangeProver)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%w: %T can't prove ranges", ErrUnsupported, s.trie)
+	}
+	return p.ProveRange(first, last)
+}
+
+// Copy implements MPT
+// The copy shares the preimage store with s.
+func (s *secureMPT) Copy() common.MPT {
+	return &secureMPT{
+		trie:      s.trie.Copy(),
+		preimages: s.preimages,
+	}
+}
+
+// StartRecording implements Recorder
+// It does nothing if the wrapped trie can't record.
+func (s *secureMPT) StartRecording() {
+	if r, ok := s.trie.(Recorder); ok {
+		r.StartRecording()
+	}
+}
+
+// StopRecording implements Recorder
+// It returns nil if the wrapped trie can't record.
+func (s *secureMPT) StopRecording() (witness ethdb.KeyValueStore) {
+	if r, ok := s.trie.(Recorder); ok {
+		return r.StopRecording()
+	}
+	return nil
+}
+
+// Commit implements Committer
+func (s *secureMPT) Commit() (root []byte, err error) {
+	return commitTrie(s.trie)
+}
+
+// Err implements MPT
+func (s *secureMPT) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.trie.Err()
+}
+
+// Reset implements types.TrieHasher
+func (s *secureMPT) Reset() {
+	s.trie.Reset()
+	s.err = nil
+}
+
+// Update implements types.TrieHasher
+// Errors are recorded rather than returned, see Err.
+func (s *secureMPT) Update(key, value []byte) {
+	if err := s.Put(key, value); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// Hash implements types.TrieHasher
+func (s *secureMPT) Hash() gethCommon.Hash {
+	return s.trie.Hash()
+}
+
+// backing implements backed
+func (s *secureMPT) backing() *mpt {
+	m, _ := trieOf(s.trie)
+	return m
+}
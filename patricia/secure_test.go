@@ -0,0 +1,110 @@
+package patricia_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	gethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	gethTrie "github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureMPT(t *testing.T) {
+	t.Run("geth cross test", func(t *testing.T) {
+		gTrie, err := gethTrie.NewStateTrie(gethCommon.Hash{}, gethCommon.Hash{}, gethTrie.NewDatabase(rawdb.NewMemoryDatabase()))
+		require.NoError(t, err)
+		trie := patricia.NewSecure(patricia.New(), nil)
+		for i := 0; i < 100; i++ {
+			key, value := []byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))
+			gTrie.Update(key, value)
+			require.NoError(t, trie.Put(key, value))
+		}
+		for i := 0; i < 100; i += 3 {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			gTrie.Delete(key)
+			require.NoError(t, trie.Delete(key))
+		}
+		require.Equal(t, gTrie.Hash().Bytes(), trie.Root())
+
+		v, err := trie.Get([]byte("key-1"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("value-1"), v)
+		_, err = trie.Get([]byte("key-0"))
+		require.ErrorIs(t, err, common.ErrKeyNotFound)
+
+		// proofs are for the hashed keys.
+		proof, err := trie.ProofFor(crypto.Keccak256([]byte("key-1")))
+		require.NoError(t, err)
+		v, err = patricia.VerifyProof(trie.Root(), crypto.Keccak256([]byte("key-1")), proof)
+		require.NoError(t, err)
+		require.Equal(t, []byte("value-1"), v)
+	})
+
+	t.Run("preimages", func(t *testing.T) {
+		trie := patricia.NewSecure(patricia.New(), rawdb.NewMemoryDatabase())
+		keys := map[string]bool{}
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			keys[key] = true
+			require.NoError(t, trie.Put([]byte(key), []byte{byte(i)}))
+		}
+
+		it := patricia.NewIterator(trie, nil)
+		for it.Next() {
+			key, err := trie.GetKey(it.Key())
+			require.NoError(t, err)
+			require.True(t, keys[string(key)], "unexpected key %s", key)
+			delete(keys, string(key))
+		}
+		require.NoError(t, it.Err())
+		require.Empty(t, keys)
+
+		_, err := trie.GetKey(crypto.Keccak256([]byte("not-there")))
+		require.ErrorIs(t, err, patricia.ErrMissingPreimage)
+	})
+
+	t.Run("no preimage store", func(t *testing.T) {
+		trie := patricia.NewSecure(patricia.New(), nil)
+		require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+		_, err := trie.GetKey(crypto.Keccak256([]byte("key")))
+		require.ErrorIs(t, err, patricia.ErrMissingPreimage)
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		inner, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		trie := patricia.NewSecure(inner, db)
+		require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+
+		inner, err = patricia.Open(root, db)
+		require.NoError(t, err)
+		trie = patricia.NewSecure(inner, db)
+		v, err := trie.Get([]byte("key"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), v)
+		key, err := trie.GetKey(crypto.Keccak256([]byte("key")))
+		require.NoError(t, err)
+		require.Equal(t, []byte("key"), key)
+	})
+
+	t.Run("wrapped trie without extensions", func(t *testing.T) {
+		// only the methods of common.MPT are promoted.
+		trie := patricia.NewSecure(struct{ common.MPT }{patricia.New()}, nil)
+		require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+		_, err := trie.(patricia.Committer).Commit()
+		require.ErrorIs(t, err, patricia.ErrUnsupported)
+		_, _, _, err = trie.(patricia.RangeProver).ProveRange(nil, nil)
+		require.ErrorIs(t, err, patricia.ErrUnsupported)
+		_, err = trie.(patricia.MultiProver).ProofForKeys(nil)
+		require.ErrorIs(t, err, patricia.ErrUnsupported)
+		trie.(patricia.Recorder).StartRecording()
+		require.Nil(t, trie.(patricia.Recorder).StopRecording())
+	})
+}
@@ -0,0 +1,345 @@
+package patricia
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	gethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// ErrUnsortedKeys is returned when a key is put into a StackTrie that
+	// isn't greater than the previous key.
+	ErrUnsortedKeys = fmt.Errorf("keys must be inserted in ascending order")
+)
+
+var _ types.TrieHasher = &StackTrie{}
+
+// StackTrie computes the root of a trie whose keys are inserted in ascending
+// order, e.g the transactions or receipts trie of a block, see
+// types.DeriveSha.
+//
+// Every subtree that only holds keys smaller than the last key can't change
+// anymore, so it is replaced by its hash as soon as it is complete. Only the
+// nodes on the path of the last key are kept in memory, which makes the memory
+// used O(depth) rather than O(keys). As a result, values can't be read back
+// from a StackTrie.
+type StackTrie struct {
+	// root is nil for an empty trie.
+	root    *stNode
+	lastKey []byte
+	err     error
+
+	hasher crypto.KeccakState
+}
+
+// stKind is the kind of a stNode.
+type stKind uint8
+
+const (
+	stLeaf stKind = iota
+	stExtension
+	stBranch
+	// stHashed is a complete subtree, of which only the reference in its
+	// parent is kept.
+	stHashed
+)
+
+// stNode is a node of a StackTrie. Unlike the nodes of an mpt, stNodes are
+// owned by a single trie and modified in place.
+type stNode struct {
+	kind stKind
+	path []byte // all nibbles, for leaves and extensions
+	// value is the value of a leaf, or the one of a branch whose key is a
+	// prefix of later keys.
+	value    []byte
+	next     *stNode     // the child of an extension
+	children [16]*stNode // the children of a branch
+	// ref is how a hashed node is referenced by its parent: its encoding if
+	// that's shorter than 32 bytes, its hash otherwise. See ref.
+	ref []byte
+}
+
+// NewStackTrie returns an empty StackTrie.
+func NewStackTrie() *StackTrie {
+	return &StackTrie{
+		hasher: crypto.NewKeccakState(),
+	}
+}
+
+// Put inserts a key-value pair into the trie. key must be greater than all
+// keys that were inserted before, otherwise ErrUnsortedKeys is returned.
+// The trie holds on to value until the subtree it's in is complete, so it
+// mustn't be modified afterwards.
+func (s *StackTrie) Put(key, value []byte) error {
+	if s.lastKey != nil && bytes.Compare(key, s.lastKey) <= 0 {
+		return fmt.Errorf("%w: %x after %x", ErrUnsortedKeys, key, s.lastKey)
+	}
+	nibbles := common.BytesToNibbles(key)
+	if s.root == nil {
+		s.root = &stNode{kind: stLeaf, path: nibbles, value: value}
+	} else if err := s.insert(s.root, nibbles, value); err != nil {
+		return err
+	}
+	// the key only matters for ordering, it may be empty.
+	if s.lastKey == nil {
+		s.lastKey = make([]byte, 0, len(key))
+	}
+	s.lastKey = append(s.lastKey[:0], key...)
+	return nil
+}
+
+// insert inserts value at nibbles into the subtree n. Since nibbles are
+// greater than all the paths in n, the new leaf always ends up right of
+// them, and the subtrees it passes on its left are complete.
+func (s *StackTrie) insert(n *stNode, nibbles, value []byte) error {
+	switch n.kind {
+	case stBranch:
+		if len(nibbles) == 0 {
+			return fmt.Errorf("%w: key ends at a branch with later keys", ErrInvariant)
+		}
+		// the children left of the new one were hashed when their right
+		// sibling was added, except for the closest one.
+		for i := int(nibbles[0]) - 1; i >= 0; i-- {
+			if c := n.children[i]; c != nil {
+				if err := s.hash(c); err != nil {
+					return err
+				}
+				break
+			}
+		}
+		child := n.children[nibbles[0]]
+		if child == nil {
+			n.children[nibbles[0]] = &stNode{kind: stLeaf, path: nibbles[1:], value: value}
+			return nil
+		}
+		return s.insert(child, nibbles[1:], value)
+	case stExtension:
+		prefix := prefixLen(n.path, nibbles)
+		if prefix == len(n.path) {
+			return s.insert(n.next, nibbles[prefix:], value)
+		}
+		if prefix == len(nibbles) {
+			return fmt.Errorf("%w: key is a prefix of an earlier key", ErrInvariant)
+		}
+		// the key diverges from the extension, which is complete.
+		old := n.next
+		if prefix < len(n.path)-1 {
+			old = &stNode{kind: stExtension, path: n.path[prefix+1:], next: n.next}
+		}
+		if err := s.hash(old); err != nil {
+			return err
+		}
+		n.split(prefix, old, nibbles, value)
+		return nil
+	case stLeaf:
+		prefix := prefixLen(n.path, nibbles)
+		if prefix == len(nibbles) {
+			return fmt.Errorf("%w: key is a prefix of an earlier key", ErrInvariant)
+		}
+		if prefix == len(n.path) {
+			// the path of the leaf is a prefix of the key, its value
+			// moves into a branch.
+			b := &stNode{kind: stBranch, value: n.value}
+			b.children[nibbles[prefix]] = &stNode{kind: stLeaf, path: nibbles[prefix+1:], value: value}
+			n.replace(prefix, b)
+			return nil
+		}
+		old := &stNode{kind: stLeaf, path: n.path[prefix+1:], value: n.value}
+		if err := s.hash(old); err != nil {
+			return err
+		}
+		n.split(prefix, old, nibbles, value)
+		return nil
+	default:
+		return fmt.Errorf("%w: insert into complete stack trie node", ErrInvariant)
+	}
+}
+
+// prefixLen returns the length of the common prefix of a and b.
+func prefixLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// split turns n, a leaf or an extension whose path diverges from nibbles
+// after prefix nibbles, into a branch holding old, what remains of n below
+// the branch, and a new leaf for value.
+func (n *stNode) split(prefix int, old *stNode, nibbles, value []byte) {
+	b := &stNode{kind: stBranch}
+	b.children[n.path[prefix]] = old
+	b.children[nibbles[prefix]] = &stNode{kind: stLeaf, path: nibbles[prefix+1:], value: value}
+	n.replace(prefix, b)
+}
+
+// replace replaces n with the branch b, behind an extension holding the
+// first prefix nibbles of the path of n if there are any.
+func (n *stNode) replace(prefix int, b *stNode) {
+	if prefix == 0 {
+		*n = *b
+		return
+	}
+	*n = stNode{kind: stExtension, path: n.path[:prefix], next: b}
+}
+
+// hash replaces the complete subtree n with its reference, see stNode.ref.
+func (s *StackTrie) hash(n *stNode) error {
+	switch n.kind {
+	case stHashed:
+		return nil
+	case stExtension:
+		if err := s.hash(n.next); err != nil {
+			return err
+		}
+	case stBranch:
+		for _, c := range n.children {
+			if c == nil {
+				continue
+			}
+			if err := s.hash(c); err != nil {
+				return err
+			}
+		}
+	}
+	enc, err := s.encode(n)
+	if err != nil {
+		return err
+	}
+	*n = stNode{kind: stHashed, ref: s.ref(enc)}
+	return nil
+}
+
+// encode returns the RLP encoding of n, in the same format as serialize.
+// Children that haven't been hashed yet are encoded as well, without
+// hashing them in place, so that the root can be computed at any time.
+func (s *StackTrie) encode(n *stNode) ([]byte, error) {
+	w := rlp.NewEncoderBuffer(nil)
+	defer w.Flush()
+	switch n.kind {
+	case stLeaf:
+		ce, err := common.CompactEncode(n.path, true)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptNode, err)
+		}
+		l := w.List()
+		w.WriteBytes(ce)
+		w.WriteBytes(n.value)
+		w.ListEnd(l)
+	case stExtension:
+		ce, err := common.CompactEncode(n.path, false)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptNode, err)
+		}
+		l := w.List()
+		w.WriteBytes(ce)
+		if err := s.writeRef(w, n.next); err != nil {
+			return nil, err
+		}
+		w.ListEnd(l)
+	case stBranch:
+		l := w.List()
+		for _, c := range n.children {
+			if err := s.writeRef(w, c); err != nil {
+				return nil, err
+			}
+		}
+		w.WriteBytes(n.value)
+		w.ListEnd(l)
+	default:
+		return nil, fmt.Errorf("%w: hashed stack trie node can't be encoded", ErrInvariant)
+	}
+	return w.ToBytes(), nil
+}
+
+// writeRef writes how the child n is represented inside its parent to w.
+func (s *StackTrie) writeRef(w rlp.EncoderBuffer, n *stNode) error {
+	if n == nil {
+		w.WriteBytes(nil)
+		return nil
+	}
+	ref := n.ref
+	if n.kind != stHashed {
+		enc, err := s.encode(n)
+		if err != nil {
+			return err
+		}
+		ref = s.ref(enc)
+	}
+	if len(ref) < 32 {
+		// embedded node.
+		w.Write(ref)
+	} else {
+		w.WriteBytes(ref)
+	}
+	return nil
+}
+
+// ref returns the reference to the node with the given encoding, see ref
+// in mpt_node.go.
+func (s *StackTrie) ref(enc []byte) []byte {
+	if len(enc) < 32 {
+		return enc
+	}
+	return s.keccak(enc)
+}
+
+func (s *StackTrie) keccak(enc []byte) []byte {
+	s.hasher.Reset()
+	s.hasher.Write(enc)
+	h := make([]byte, 32)
+	s.hasher.Read(h)
+	return h
+}
+
+// Root returns the merkle root of the keys inserted so far, or nil if it
+// can't be computed, see Err.
+func (s *StackTrie) Root() []byte {
+	if s.root == nil {
+		return emptyRoot
+	}
+	enc, err := s.encode(s.root)
+	if err != nil {
+		s.setErr(err)
+		return nil
+	}
+	return s.keccak(enc)
+}
+
+// Err returns the first error Update or Hash ran into, if any.
+func (s *StackTrie) Err() error {
+	return s.err
+}
+
+func (s *StackTrie) setErr(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Reset implements types.TrieHasher
+func (s *StackTrie) Reset() {
+	s.root = nil
+	s.lastKey = nil
+	s.err = nil
+}
+
+// Update implements types.TrieHasher
+// Errors are recorded rather than returned, see Err.
+func (s *StackTrie) Update(key, value []byte) {
+	if err := s.Put(key, value); err != nil {
+		s.setErr(err)
+	}
+}
+
+// Hash implements types.TrieHasher
+// Errors are recorded rather than returned, see Err.
+func (s *StackTrie) Hash() gethCommon.Hash {
+	return gethCommon.BytesToHash(s.Root())
+}
@@ -0,0 +1,146 @@
+package patricia_test
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStackTrie(t *testing.T) {
+	t.Run("empty trie", func(t *testing.T) {
+		require.Equal(t, patricia.New().Root(), patricia.NewStackTrie().Root())
+	})
+
+	t.Run("transactions root", func(t *testing.T) {
+		for _, block := range []string{"10467135", "16614538"} {
+			header := headerFromJSON(t, fmt.Sprintf("testdata/%s/header.json", block))
+			txs := transactionsFromJSON(t, fmt.Sprintf("testdata/%s/txs.json", block))
+			st := patricia.NewStackTrie()
+			require.Equal(t, header.TxHash, types.DeriveSha(txs, st), "block %s", block)
+			require.NoError(t, st.Err())
+		}
+	})
+
+	t.Run("receipts root", func(t *testing.T) {
+		header := headerFromJSON(t, "testdata/16614538/header.json")
+		receipts := receiptsFromJSON(t, "testdata/16614538/receipts.json")
+		st := patricia.NewStackTrie()
+		require.Equal(t, header.ReceiptHash, types.DeriveSha(receipts, st))
+		require.NoError(t, st.Err())
+	})
+
+	t.Run("sorted keys of varying length", func(t *testing.T) {
+		var keys [][]byte
+		seen := map[string]bool{}
+		for i := 0; i < 500; i++ {
+			key := crypto.Keccak256([]byte{byte(i), byte(i >> 8)})[:1+i%6]
+			if seen[string(key)] {
+				continue
+			}
+			seen[string(key)] = true
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i], keys[j]) < 0
+		})
+
+		trie := patricia.New()
+		st := patricia.NewStackTrie()
+		for i, key := range keys {
+			value := []byte(fmt.Sprintf("value-%d", i))
+			require.NoError(t, trie.Put(key, value))
+			require.NoError(t, st.Put(key, value))
+			require.Equal(t, trie.Root(), st.Root(), "mismatch after key %d", i)
+		}
+	})
+
+	t.Run("keys that are prefixes of later keys", func(t *testing.T) {
+		// the values of the prefixes end up in branches.
+		keys := [][]byte{{}, {0x01}, {0x01, 0x02}, {0x01, 0x02, 0x03}, {0x01, 0x03}, {0x01, 0x30}, {0x10}, {0x10, 0x00}}
+		trie := patricia.New()
+		st := patricia.NewStackTrie()
+		for i, key := range keys {
+			value := bytes.Repeat([]byte{byte(i)}, 1+i*5)
+			require.NoError(t, trie.Put(key, value))
+			require.NoError(t, st.Put(key, value))
+			require.Equal(t, trie.Root(), st.Root(), "mismatch after key %d", i)
+		}
+	})
+
+	t.Run("unsorted keys", func(t *testing.T) {
+		st := patricia.NewStackTrie()
+		require.NoError(t, st.Put([]byte{0x02}, []byte("b")))
+		require.ErrorIs(t, st.Put([]byte{0x01}, []byte("a")), patricia.ErrUnsortedKeys)
+		require.ErrorIs(t, st.Put([]byte{0x02}, []byte("b")), patricia.ErrUnsortedKeys)
+		st.Update([]byte{0x01}, []byte("a"))
+		require.ErrorIs(t, st.Err(), patricia.ErrUnsortedKeys)
+
+		// the rejected keys didn't change the trie.
+		trie := patricia.New()
+		require.NoError(t, trie.Put([]byte{0x02}, []byte("b")))
+		require.Equal(t, trie.Root(), st.Root())
+
+		st.Reset()
+		require.NoError(t, st.Err())
+		require.NoError(t, st.Put([]byte{0x01}, []byte("a")))
+	})
+}
+
+func BenchmarkStackTrie(b *testing.B) {
+	txs := transactionsFromJSON(b, "testdata/16614538/txs.json")
+	receipts := receiptsFromJSON(b, "testdata/16614538/receipts.json")
+	for _, bm := range []struct {
+		name string
+		list types.DerivableList
+	}{{"txs", txs}, {"receipts", receipts}} {
+		list := bm.list
+		b.Run(bm.name+"/mpt", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				types.DeriveSha(list, patricia.New())
+			}
+		})
+		b.Run(bm.name+"/stack trie", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				types.DeriveSha(list, patricia.NewStackTrie())
+			}
+		})
+	}
+}
+
+func BenchmarkParallelHashing(b *testing.B) {
+	var keys [][]byte
+	for i := 0; i < 20000; i++ {
+		keys = append(keys, crypto.Keccak256([]byte(fmt.Sprint(i))))
+	}
+	for _, bm := range []struct {
+		name string
+		opts []patricia.Option
+	}{
+		{"sequential", nil},
+		{"parallel", []patricia.Option{patricia.WithParallelHashing(0, 0)}},
+	} {
+		opts := bm.opts
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				trie := patricia.New(opts...)
+				for _, key := range keys {
+					if err := trie.Put(key, key); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StartTimer()
+				trie.Root()
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package patricia
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	gethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// emptyCodeHash is the code hash of accounts without code.
+	emptyCodeHash = crypto.Keccak256(nil)
+	// preimagePrefix is the prefix of the preimages in the database of a
+	// state trie, the same as geth's.
+	preimagePrefix = []byte("secure-key-")
+)
+
+// StateTrie is an ethereum state trie: a secure trie that maps addresses to
+// rlp([nonce, balance, storageRoot, codeHash]) accounts, along with a secure
+// storage trie for each account. The storage root of an account is kept in
+// sync with its storage trie whenever the state root is computed.
+type StateTrie struct {
+	accounts common.SecureMPT
+	// storage holds the storage tries that were opened so far. Their roots
+	// are written to the accounts in dirty when the state root is computed.
+	storage map[gethCommon.Address]common.SecureMPT
+	dirty   map[gethCommon.Address]bool
+	db      ethdb.KeyValueStore
+}
+
+// NewStateTrie returns the state trie with the given root, whose nodes
+// (including the nodes of all storage tries) are stored in db. db is also
+// used to record the preimages of addresses and storage slots, under the
+// "secure-key-" prefix so that they can't be mistaken for nodes.
+// If db is nil, the state trie is in-memory only and root must be empty.
+func NewStateTrie(root []byte, db ethdb.KeyValueStore) (*StateTrie, error) {
+	accounts, err := openSecure(root, db)
+	if err != nil {
+		return nil, err
+	}
+	return &StateTrie{
+		accounts: accounts,
+		storage:  make(map[gethCommon.Address]common.SecureMPT),
+		dirty:    make(map[gethCommon.Address]bool),
+		db:       db,
+	}, nil
+}
+
+// openSecure opens the secure trie with the given root in db, or an
+// in-memory one if db is nil.
+func openSecure(root []byte, db ethdb.KeyValueStore) (common.SecureMPT, error) {
+	if db == nil {
+		if len(root) != 0 && !bytes.Equal(root, emptyRoot) {
+			return nil, fmt.Errorf("%w: %x", ErrMissingNode, root)
+		}
+		return NewSecure(New(), nil), nil
+	}
+	trie, err := Open(root, db)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecure(trie, prefixedStore{db: db, prefix: preimagePrefix}), nil
+}
+
+// prefixedStore is a PreimageStore that keeps its keys in db under prefix.
+type prefixedStore struct {
+	db     ethdb.KeyValueStore
+	prefix []byte
+}
+
+// Has implements ethdb.KeyValueReader
+func (p prefixedStore) Has(key []byte) (bool, error) {
+	return p.db.Has(common.Concat(p.prefix, key))
+}
+
+// Get implements ethdb.KeyValueReader
+func (p prefixedStore) Get(key []byte) ([]byte, error) {
+	return p.db.Get(common.Concat(p.prefix, key))
+}
+
+// Put implements ethdb.KeyValueWriter
+func (p prefixedStore) Put(key, value []byte) error {
+	return p.db.Put(common.Concat(p.prefix, key), value)
+}
+
+// Delete implements ethdb.KeyValueWriter
+func (p prefixedStore) Delete(key []byte) error {
+	return p.db.Delete(common.Concat(p.prefix, key))
+}
+
+// GetAccount returns the account at addr, or common.ErrKeyNotFound if there
+// is none.
+func (s *StateTrie) GetAccount(addr gethCommon.Address) (*types.StateAccount, error) {
+	enc, err := s.accounts.Get(addr.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	acc := new(types.StateAccount)
+	if err := rlp.DecodeBytes(enc, acc); err != nil {
+		return nil, fmt.Errorf("%w: account %s: %v", ErrMalformedNode, addr, err)
+	}
+	if storage, ok := s.storage[addr]; ok {
+		root := storage.Root()
+		if root == nil {
+			return nil, storage.Err()
+		}
+		acc.Root = gethCommon.BytesToHash(root)
+	}
+	return acc, nil
+}
+
+// UpdateAccount sets the account at addr. If the storage of addr was
+// opened (see GetStorage and SetStorage), the storage root of acc is
+// replaced by the root of the storage trie.
+func (s *StateTrie) UpdateAccount(addr gethCommon.Address, acc *types.StateAccount) error {
+	if _, ok := s.storage[addr]; ok {
+		s.dirty[addr] = true
+	}
+	return s.putAccount(addr, acc)
+}
+
+// DeleteAccount removes the account at addr, along with its storage.
+func (s *StateTrie) DeleteAccount(addr gethCommon.Address) error {
+	delete(s.storage, addr)
+	delete(s.dirty, addr)
+	return s.accounts.Delete(addr.Bytes())
+}
+
+// GetStorage returns the value of the given storage slot of addr. Slots
+// that were never set, as well as the slots of missing accounts, are zero.
+func (s *StateTrie) GetStorage(addr gethCommon.Address, slot gethCommon.Hash) (gethCommon.Hash, error) {
+	storage, err := s.openStorage(addr)
+	if errors.Is(err, common.ErrKeyNotFound) {
+		return gethCommon.Hash{}, nil
+	}
+	if err != nil {
+		return gethCommon.Hash{}, err
+	}
+	enc, err := storage.Get(slot.Bytes())
+	if errors.Is(err, common.ErrKeyNotFound) {
+		return gethCommon.Hash{}, nil
+	}
+	if err != nil {
+		return gethCommon.Hash{}, err
+	}
+	// values are stored as rlp encoded byte strings with leading zeroes
+	// trimmed, as in ethereum.
+	_, content, _, err := rlp.Split(enc)
+	if err != nil {
+		return gethCommon.Hash{}, fmt.Errorf("%w: storage slot %s of %s: %v", ErrMalformedNode, slot, addr, err)
+	}
+	return gethCommon.BytesToHash(content), nil
+}
+
+// SetStorage sets the given storage slot of addr to value. Setting a slot to
+// zero removes it. If there is no account at addr, an empty one is created.
+func (s *StateTrie) SetStorage(addr gethCommon.Address, slot, value gethCommon.Hash) error {
+	storage, err := s.openStorage(addr)
+	if errors.Is(err, common.ErrKeyNotFound) {
+		err = s.putAccount(addr, &types.StateAccount{Balance: new(big.Int)})
+		if err != nil {
+			return err
+		}
+		storage, err = s.openStorage(addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.dirty[addr] = true
+	if value == (gethCommon.Hash{}) {
+		return storage.Delete(slot.Bytes())
+	}
+	enc, err := rlp.EncodeToBytes(gethCommon.TrimLeftZeroes(value.Bytes()))
+	if err != nil {
+		return err
+	}
+	return storage.Put(slot.Bytes(), enc)
+}
+
+// Root returns the state root, after updating the storage roots of all
+// accounts whose storage changed.
+func (s *StateTrie) Root() ([]byte, error) {
+	if err := s.updateStorageRoots(); err != nil {
+		return nil, err
+	}
+	root := s.accounts.Root()
+	if root == nil {
+		return nil, s.accounts.Err()
+	}
+	return root, nil
+}
+
+// Commit writes all storage tries and the state trie to the database and
+// returns the state root.
+func (s *StateTrie) Commit() (root []byte, err error) {
+	if s.db == nil {
+		return nil, ErrNoDatabase
+	}
+	if err := s.updateStorageRoots(); err != nil {
+		return nil, err
+	}
+	for addr := range s.storage {
+		if _, err := commitTrie(s.storage[addr]); err != nil {
+			return nil, err
+		}
+	}
+	return commitTrie(s.accounts)
+}
+
+// openStorage returns the storage trie of addr, opening it if needed.
+func (s *StateTrie) openStorage(addr gethCommon.Address) (common.SecureMPT, error) {
+	if storage, ok := s.storage[addr]; ok {
+		return storage, nil
+	}
+	acc, err := s.GetAccount(addr)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := openSecure(acc.Root.Bytes(), s.db)
+	if err != nil {
+		return nil, err
+	}
+	s.storage[addr] = storage
+	return storage, nil
+}
+
+// updateStorageRoots writes the storage roots of all accounts whose
+// storage changed to the accounts.
+func (s *StateTrie) updateStorageRoots() error {
+	for addr := range s.dirty {
+		acc, err := s.GetAccount(addr)
+		if err != nil {
+			return err
+		}
+		if err := s.putAccount(addr, acc); err != nil {
+			return err
+		}
+		delete(s.dirty, addr)
+	}
+	return nil
+}
+
+// putAccount writes acc to the account trie. Accounts without a storage
+// root or code hash get the ones of empty storage and no code.
+func (s *StateTrie) putAccount(addr gethCommon.Address, acc *types.StateAccount) error {
+	normalized := *acc
+	if normalized.Root == (gethCommon.Hash{}) {
+		normalized.Root = gethCommon.BytesToHash(emptyRoot)
+	}
+	if normalized.CodeHash == nil {
+		normalized.CodeHash = emptyCodeHash
+	}
+	enc, err := rlp.EncodeToBytes(&normalized)
+	if err != nil {
+		return err
+	}
+	return s.accounts.Put(addr.Bytes(), enc)
+}
@@ -0,0 +1,170 @@
+package patricia_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	gethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+// stateFromAlloc builds a state trie holding the given genesis allocation.
+func stateFromAlloc(t *testing.T, s *patricia.StateTrie, alloc core.GenesisAlloc) {
+	for addr, account := range alloc {
+		balance := account.Balance
+		if balance == nil {
+			balance = new(big.Int)
+		}
+		require.NoError(t, s.UpdateAccount(addr, &types.StateAccount{
+			Nonce:    account.Nonce,
+			Balance:  balance,
+			CodeHash: crypto.Keccak256(account.Code),
+		}))
+		for slot, value := range account.Storage {
+			require.NoError(t, s.SetStorage(addr, slot, value))
+		}
+	}
+}
+
+// gethStateRoot computes the state root of the given genesis allocation
+// with geth.
+func gethStateRoot(t *testing.T, alloc core.GenesisAlloc) []byte {
+	statedb, err := state.New(gethCommon.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	for addr, account := range alloc {
+		statedb.SetBalance(addr, account.Balance)
+		statedb.SetNonce(addr, account.Nonce)
+		statedb.SetCode(addr, account.Code)
+		for slot, value := range account.Storage {
+			statedb.SetState(addr, slot, value)
+		}
+	}
+	return statedb.IntermediateRoot(false).Bytes()
+}
+
+func TestStateTrie(t *testing.T) {
+	t.Run("mainnet genesis", func(t *testing.T) {
+		s, err := patricia.NewStateTrie(nil, nil)
+		require.NoError(t, err)
+		stateFromAlloc(t, s, core.DefaultGenesisBlock().Alloc)
+		root, err := s.Root()
+		require.NoError(t, err)
+		require.Equal(t, gethCommon.HexToHash("0xd7f8974fb5ac78d9ac099b9ad5018bedc2ce0a72dad1827a1709da30580f0544").Bytes(), root)
+	})
+
+	t.Run("genesis alloc with storage", func(t *testing.T) {
+		b, err := os.ReadFile(filepath.Join("testdata", "genesis", "alloc.json"))
+		require.NoError(t, err)
+		var alloc core.GenesisAlloc
+		require.NoError(t, json.Unmarshal(b, &alloc))
+
+		s, err := patricia.NewStateTrie(nil, nil)
+		require.NoError(t, err)
+		stateFromAlloc(t, s, alloc)
+		root, err := s.Root()
+		require.NoError(t, err)
+		require.Equal(t, gethStateRoot(t, alloc), root)
+
+		addr := gethCommon.HexToAddress("0x8a04d14125d0fdcdc742f4a05c051de07232edc4")
+		acc, err := s.GetAccount(addr)
+		require.NoError(t, err)
+		require.Equal(t, alloc[addr].Balance, acc.Balance)
+		value, err := s.GetStorage(addr, gethCommon.Hash{})
+		require.NoError(t, err)
+		require.Equal(t, gethCommon.HexToHash("0x71562b71999873db5b286df957af199ec94617f7"), value)
+
+		// clearing a slot changes the storage root, and with it the state root.
+		require.NoError(t, s.SetStorage(addr, gethCommon.Hash{}, gethCommon.Hash{}))
+		value, err = s.GetStorage(addr, gethCommon.Hash{})
+		require.NoError(t, err)
+		require.Equal(t, gethCommon.Hash{}, value)
+		delete(alloc[addr].Storage, gethCommon.Hash{})
+		root, err = s.Root()
+		require.NoError(t, err)
+		require.Equal(t, gethStateRoot(t, alloc), root)
+		acc, err = s.GetAccount(addr)
+		require.NoError(t, err)
+		require.Equal(t, gethCommon.BytesToHash(crypto.Keccak256([]byte{0x80})), acc.Root)
+	})
+
+	t.Run("missing account", func(t *testing.T) {
+		s, err := patricia.NewStateTrie(nil, nil)
+		require.NoError(t, err)
+		addr := gethCommon.HexToAddress("0x01")
+		_, err = s.GetAccount(addr)
+		require.ErrorIs(t, err, common.ErrKeyNotFound)
+		value, err := s.GetStorage(addr, gethCommon.Hash{})
+		require.NoError(t, err)
+		require.Equal(t, gethCommon.Hash{}, value)
+
+		// setting storage creates the account.
+		require.NoError(t, s.SetStorage(addr, gethCommon.Hash{}, gethCommon.HexToHash("0x2a")))
+		acc, err := s.GetAccount(addr)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), acc.Nonce)
+
+		require.NoError(t, s.DeleteAccount(addr))
+		root, err := s.Root()
+		require.NoError(t, err)
+		require.Equal(t, patricia.New().Root(), root)
+	})
+
+	t.Run("commit and reopen", func(t *testing.T) {
+		b, err := os.ReadFile(filepath.Join("testdata", "genesis", "alloc.json"))
+		require.NoError(t, err)
+		var alloc core.GenesisAlloc
+		require.NoError(t, json.Unmarshal(b, &alloc))
+
+		db := rawdb.NewMemoryDatabase()
+		s, err := patricia.NewStateTrie(nil, db)
+		require.NoError(t, err)
+		stateFromAlloc(t, s, alloc)
+		root, err := s.Commit()
+		require.NoError(t, err)
+		require.Equal(t, gethStateRoot(t, alloc), root)
+
+		// the database only holds nodes, keyed by their hash, and the
+		// preimages of addresses and slots, under their own prefix.
+		preimages := 0
+		it := db.NewIterator(nil, nil)
+		for it.Next() {
+			if bytes.HasPrefix(it.Key(), []byte("secure-key-")) {
+				preimages++
+				continue
+			}
+			require.Equal(t, crypto.Keccak256(it.Value()), it.Key())
+		}
+		it.Release()
+		require.NoError(t, it.Error())
+		require.NotZero(t, preimages)
+		for addr := range alloc {
+			preimage, err := db.Get(append([]byte("secure-key-"), crypto.Keccak256(addr.Bytes())...))
+			require.NoError(t, err)
+			require.Equal(t, addr.Bytes(), preimage)
+		}
+
+		s, err = patricia.NewStateTrie(root, db)
+		require.NoError(t, err)
+		for addr, account := range alloc {
+			acc, err := s.GetAccount(addr)
+			require.NoError(t, err)
+			require.Equal(t, account.Nonce, acc.Nonce)
+			for slot, expected := range account.Storage {
+				value, err := s.GetStorage(addr, slot)
+				require.NoError(t, err)
+				require.Equal(t, expected, value)
+			}
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package patricia
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+)
+
+// TrieStats describes the structure of a trie, see Stats.
+type TrieStats struct {
+	Leaves, Extensions, Branches int
+	// Values is the number of values in the trie, i.e the number of leaves
+	// plus the number of branches that hold a value.
+	Values int
+	// DepthHistogram counts the values by their depth, DepthHistogram[d]
+	// being the number of values stored in a node d levels below the root.
+	DepthHistogram []int
+	// AverageFanOut is the average number of children of the branches.
+	AverageFanOut float64
+	// EmbeddedNodes is the number of nodes that are small enough (less than
+	// 32 bytes) to be embedded in their parent, HashedNodes the number of
+	// nodes that are referenced by hash. The root is always hashed.
+	EmbeddedNodes, HashedNodes int
+	// EncodedSize is the total size of the encodings of the hashed nodes,
+	// i.e the size of the trie when it is stored in a database (without the
+	// keys).
+	EncodedSize int
+	// MissingNodes is the number of subtrees that aren't available, e.g in
+	// a trie built by FromProof.
+	MissingNodes int
+	// ValueSizeHistogram counts the values by their size in powers of two,
+	// ValueSizeHistogram[i] being the number of values whose size needs i
+	// bits, i.e is in [2^(i-1), 2^i). Empty values are counted at index 0.
+	ValueSizeHistogram []int
+	// TotalValueSize, MinValueSize and MaxValueSize are in bytes.
+	TotalValueSize, MinValueSize, MaxValueSize int
+}
+
+// Stats walks all nodes of t and reports on its structure. It is meant for
+// capacity planning and for comparing how different key schemes, such as raw
+// vs hashed keys, shape a trie with the same data.
+func Stats(t common.MPT) (*TrieStats, error) {
+	m, err := trieOf(t)
+	if err != nil {
+		return nil, err
+	}
+	s := &TrieStats{}
+	if m.root == nil {
+		return s, nil
+	}
+	var children int
+	if err := s.collect(m, m.root, 0, true, &children); err != nil {
+		return nil, err
+	}
+	if s.Branches > 0 {
+		s.AverageFanOut = float64(children) / float64(s.Branches)
+	}
+	return s, nil
+}
+
+// collect adds the subtree referenced by ref at the given depth to s.
+// children counts the children of all branches.
+func (s *TrieStats) collect(m *mpt, ref mptNode, depth int, isRoot bool, children *int) error {
+	n, err := m.load(ref)
+	if errors.Is(err, ErrMissingNode) {
+		s.MissingNodes++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	enc, err := serialize(n)
+	if err != nil {
+		return err
+	}
+	if _, ok := ref.(hashNode); ok || isRoot || len(enc) >= 32 {
+		s.HashedNodes++
+		s.EncodedSize += len(enc)
+	} else {
+		s.EmbeddedNodes++
+	}
+
+	switch n := n.(type) {
+	case *leafNode:
+		s.Leaves++
+		s.addValue(n.value, depth)
+	case *extensionNode:
+		s.Extensions++
+		return s.collect(m, n.next, depth+1, false, children)
+	case *branchNode:
+		s.Branches++
+		if n.value != nil {
+			s.addValue(n.value, depth)
+		}
+		for _, c := range n.children {
+			if c == nil {
+				continue
+			}
+			*children++
+			if err := s.collect(m, c, depth+1, false, children); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *TrieStats) addValue(value []byte, depth int) {
+	if s.Values == 0 || len(value) < s.MinValueSize {
+		s.MinValueSize = len(value)
+	}
+	if len(value) > s.MaxValueSize {
+		s.MaxValueSize = len(value)
+	}
+	s.Values++
+	s.TotalValueSize += len(value)
+	s.DepthHistogram = increment(s.DepthHistogram, depth)
+	s.ValueSizeHistogram = increment(s.ValueSizeHistogram, bits.Len(uint(len(value))))
+}
+
+// increment increments h[i], growing h if needed.
+func increment(h []int, i int) []int {
+	for len(h) <= i {
+		h = append(h, 0)
+	}
+	h[i]++
+	return h
+}
+
+// String formats the statistics as a human readable report.
+func (s *TrieStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "nodes: %d branches, %d extensions, %d leaves\n", s.Branches, s.Extensions, s.Leaves)
+	fmt.Fprintf(&b, "hashed nodes: %d (%d bytes), embedded nodes: %d\n", s.HashedNodes, s.EncodedSize, s.EmbeddedNodes)
+	if s.MissingNodes > 0 {
+		fmt.Fprintf(&b, "missing nodes: %d\n", s.MissingNodes)
+	}
+	fmt.Fprintf(&b, "average branch fan-out: %.2f\n", s.AverageFanOut)
+	fmt.Fprintf(&b, "values: %d (%d bytes, min %d, max %d)\n", s.Values, s.TotalValueSize, s.MinValueSize, s.MaxValueSize)
+	b.WriteString("values by depth:\n")
+	for depth, count := range s.DepthHistogram {
+		if count > 0 {
+			fmt.Fprintf(&b, "  %3d: %d\n", depth, count)
+		}
+	}
+	b.WriteString("values by size:\n")
+	for i, count := range s.ValueSizeHistogram {
+		if count == 0 {
+			continue
+		}
+		if i == 0 {
+			fmt.Fprintf(&b, "  0 bytes: %d\n", count)
+		} else {
+			fmt.Fprintf(&b, "  %d-%d bytes: %d\n", 1<<(i-1), 1<<i-1, count)
+		}
+	}
+	return b.String()
+}
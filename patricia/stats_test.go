@@ -0,0 +1,82 @@
+package patricia_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	t.Run("example trie", func(t *testing.T) {
+		s, err := patricia.Stats(exampleTrie(t))
+		require.NoError(t, err)
+		require.NotZero(t, s.EncodedSize)
+		s.EncodedSize = 0
+		require.Equal(t, &patricia.TrieStats{
+			Leaves:             3,
+			Extensions:         1,
+			Branches:           2,
+			Values:             4,
+			DepthHistogram:     []int{0, 1, 1, 2},
+			AverageFanOut:      2,
+			EmbeddedNodes:      3,
+			HashedNodes:        3,
+			ValueSizeHistogram: []int{0, 3, 0, 0, 0, 0, 1},
+			TotalValueSize:     40,
+			MinValueSize:       1,
+			MaxValueSize:       37,
+		}, s)
+	})
+
+	t.Run("empty trie", func(t *testing.T) {
+		s, err := patricia.Stats(patricia.New())
+		require.NoError(t, err)
+		require.Equal(t, &patricia.TrieStats{}, s)
+	})
+
+	t.Run("encoded size matches the database", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for i := 0; i < 500; i++ {
+			require.NoError(t, trie.Put([]byte(fmt.Sprint(i)), []byte{byte(i)}))
+		}
+		before, err := patricia.Stats(trie)
+		require.NoError(t, err)
+		_, err = trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+
+		nodes, size := proofSize(t, db)
+		require.Equal(t, before.HashedNodes, nodes)
+		require.Equal(t, before.EncodedSize, size)
+
+		// the stats of the committed trie are the same, even though
+		// its nodes have to be loaded.
+		after, err := patricia.Stats(trie)
+		require.NoError(t, err)
+		require.Equal(t, before, after)
+	})
+
+	t.Run("raw vs hashed keys", func(t *testing.T) {
+		raw := patricia.New()
+		hashed := patricia.NewSecure(patricia.New(), nil)
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("key-%04d", i))
+			require.NoError(t, raw.Put(key, key))
+			require.NoError(t, hashed.Put(key, key))
+		}
+		rawStats, err := patricia.Stats(raw)
+		require.NoError(t, err)
+		hashedStats, err := patricia.Stats(hashed)
+		require.NoError(t, err)
+		require.Equal(t, 1000, rawStats.Values)
+		require.Equal(t, 1000, hashedStats.Values)
+		// sequential raw keys share long prefixes, which makes for dense
+		// branches, while hashed keys spread out right below the root.
+		require.Greater(t, rawStats.AverageFanOut, hashedStats.AverageFanOut)
+		t.Logf("raw keys:\n%s\nhashed keys:\n%s", rawStats, hashedStats)
+	})
+}
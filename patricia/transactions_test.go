@@ -26,7 +26,7 @@ func headerFromJSON(t *testing.T, headerJSONPath string) (h *types.Header) {
 	return
 }
 
-func transactionsFromJSON(t *testing.T, txsJSONPath string) (r types.Transactions) {
+func transactionsFromJSON(t testing.TB, txsJSONPath string) (r types.Transactions) {
 	f, err := os.Open(txsJSONPath)
 	require.NoError(t, err)
 	defer f.Close()
@@ -0,0 +1,177 @@
+package patricia
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// ErrInvalidBranch is reported for branches that hold fewer than two
+	// entries (children and value), which should have been collapsed.
+	ErrInvalidBranch = fmt.Errorf("invalid branch node")
+	// ErrInvalidExtension is reported for extensions with an empty path or
+	// whose child isn't a branch.
+	ErrInvalidExtension = fmt.Errorf("invalid extension node")
+	// ErrInvalidReference is reported for nodes that are referenced by hash
+	// although they are small enough to be embedded in their parent.
+	ErrInvalidReference = fmt.Errorf("invalid node reference")
+)
+
+// Violation is a broken invariant found by Validate.
+type Violation struct {
+	// Path is the path of the offending node from the root, in nibbles.
+	Path []byte
+	Err  error
+}
+
+// Error implements error
+func (v Violation) Error() string {
+	return fmt.Sprintf("%v at path %s", v.Err, nibbleString(v.Path))
+}
+
+// Unwrap returns the underlying error, so that violations can be matched
+// with errors.Is.
+func (v Violation) Unwrap() error {
+	return v.Err
+}
+
+// Validate walks the whole trie and checks the invariants that Put and
+// Delete maintain, reporting every violation it finds rather than just the
+// first one:
+//
+//   - branches hold at least two entries (ErrInvalidBranch).
+//   - extensions have a non-empty path and a branch as their child
+//     (ErrInvalidExtension).
+//   - nodes are referenced by hash only if they're too large to be embedded
+//     (ErrInvalidReference).
+//   - stored nodes hash to the hash they're referenced by, and cached hashes
+//     and encodings match the nodes (ErrHashMismatch).
+//   - all nodes can be loaded (ErrMissingNode) and decoded (ErrMalformedNode).
+//
+// Nodes that are referenced by hash are read from the database and checked,
+// whether they were loaded before or not, so Validate can be used to check
+// the integrity of a persisted trie.
+// The returned error is only set if t isn't implemented by this package.
+func Validate(t common.MPT) ([]Violation, error) {
+	m, err := trieOf(t)
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{m: m}
+	if m.root != nil {
+		v.validate(m.root, nil, true)
+	}
+	return v.violations, nil
+}
+
+type validator struct {
+	m          *mpt
+	violations []Violation
+}
+
+func (v *validator) report(path []byte, err error) {
+	v.violations = append(v.violations, Violation{Path: path, Err: err})
+}
+
+// validate checks the subtree referenced by ref, whose path from the root
+// is path, and returns its top node. It returns nil if the node isn't
+// available.
+func (v *validator) validate(ref mptNode, path []byte, isRoot bool) mptNode {
+	n := ref
+	if h, ok := ref.(hashNode); ok {
+		n = v.load(h, path, isRoot)
+		if n == nil {
+			return nil
+		}
+	}
+
+	switch n := n.(type) {
+	case *extensionNode:
+		if len(n.path) == 0 {
+			v.report(path, fmt.Errorf("%w: empty path", ErrInvalidExtension))
+		}
+		switch v.validate(n.next, common.Concat(path, n.path), false).(type) {
+		case *leafNode:
+			v.report(path, fmt.Errorf("%w: child is a leaf", ErrInvalidExtension))
+		case *extensionNode:
+			v.report(path, fmt.Errorf("%w: child is an extension", ErrInvalidExtension))
+		case nil:
+			if n.next == nil {
+				v.report(path, fmt.Errorf("%w: no child", ErrInvalidExtension))
+			}
+		}
+	case *branchNode:
+		entries := 0
+		if n.value != nil {
+			entries++
+		}
+		for i, c := range n.children {
+			if c == nil {
+				continue
+			}
+			entries++
+			v.validate(c, common.Concat(path, []byte{byte(i)}), false)
+		}
+		if entries < 2 {
+			v.report(path, fmt.Errorf("%w: %d entries", ErrInvalidBranch, entries))
+		}
+	}
+
+	// the children are checked first, so their cached encodings can be
+	// relied upon when encoding n again.
+	v.checkCache(n, path)
+	return n
+}
+
+// load reads the node referenced by h from the database and checks it.
+func (v *validator) load(h hashNode, path []byte, isRoot bool) mptNode {
+	var enc []byte
+	if v.m.db != nil {
+		enc, _ = v.m.db.Get(h)
+	}
+	if len(enc) == 0 {
+		v.report(path, fmt.Errorf("%w: %x", ErrMissingNode, []byte(h)))
+		return nil
+	}
+	if !bytes.Equal(crypto.Keccak256(enc), h) {
+		v.report(path, fmt.Errorf("%w: node stored under %x", ErrHashMismatch, []byte(h)))
+	}
+	if len(enc) < 32 && !isRoot {
+		v.report(path, fmt.Errorf("%w: node of size %d referenced by hash", ErrInvalidReference, len(enc)))
+	}
+	n, err := decodeNode(enc)
+	if err != nil {
+		v.report(path, err)
+		return nil
+	}
+	return n
+}
+
+// checkCache checks that the cached encoding and hash of n, if any, are
+// those of n.
+func (v *validator) checkCache(n mptNode, path []byte) {
+	flags := n.cache()
+	if flags == nil || (flags.enc == nil && flags.hash == nil) {
+		return
+	}
+	items, err := n.preRLP()
+	if err != nil {
+		v.report(path, err)
+		return
+	}
+	enc, err := rlp.EncodeToBytes(items)
+	if err != nil {
+		v.report(path, fmt.Errorf("%w: %v", ErrMalformedNode, err))
+		return
+	}
+	if flags.enc != nil && !bytes.Equal(flags.enc, enc) {
+		v.report(path, fmt.Errorf("%w: cached encoding is stale", ErrHashMismatch))
+	}
+	if flags.hash != nil && !bytes.Equal(flags.hash, crypto.Keccak256(enc)) {
+		v.report(path, fmt.Errorf("%w: cached hash is stale", ErrHashMismatch))
+	}
+}
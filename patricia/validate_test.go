@@ -0,0 +1,154 @@
+package patricia_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+// storeNode writes the encoding of the given node items to db and returns
+// its hash.
+func storeNode(t *testing.T, db ethdb.KeyValueWriter, items ...any) []byte {
+	enc, err := rlp.EncodeToBytes(items)
+	require.NoError(t, err)
+	h := crypto.Keccak256(enc)
+	require.NoError(t, db.Put(h, enc))
+	return h
+}
+
+// compact returns the compact encoding of nibbles.
+func compact(t *testing.T, nibbles []byte, isLeaf bool) []byte {
+	enc, err := common.CompactEncode(nibbles, isLeaf)
+	require.NoError(t, err)
+	return enc
+}
+
+func TestValidate(t *testing.T) {
+	largeValue := []byte("a value that is long enough to not be embedded")
+
+	t.Run("valid tries", func(t *testing.T) {
+		violations, err := patricia.Validate(exampleTrie(t))
+		require.NoError(t, err)
+		require.Empty(t, violations)
+
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for i := 0; i < 500; i++ {
+			require.NoError(t, trie.Put([]byte(fmt.Sprint(i)), largeValue))
+		}
+		violations, err = patricia.Validate(trie)
+		require.NoError(t, err)
+		require.Empty(t, violations)
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		trie, err = patricia.Open(root, db)
+		require.NoError(t, err)
+		violations, err = patricia.Validate(trie)
+		require.NoError(t, err)
+		require.Empty(t, violations)
+	})
+
+	t.Run("missing and corrupted nodes", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, trie.Put(crypto.Keccak256([]byte{byte(i)}), largeValue))
+		}
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+
+		// the leaves of two keys are removed, and the one of another key
+		// is replaced.
+		leafHash := func(i int) (h []byte) {
+			proof, err := trie.ProofFor(crypto.Keccak256([]byte{byte(i)}))
+			require.NoError(t, err)
+			it := proof.(ethdb.Iteratee).NewIterator(nil, nil)
+			defer it.Release()
+			// the leaf is the only node in the proof that holds the value.
+			for it.Next() {
+				if bytes.HasSuffix(it.Value(), largeValue) {
+					h = common.Concat(it.Key(), nil)
+				}
+			}
+			require.NotNil(t, h)
+			return h
+		}
+		require.NoError(t, db.Delete(leafHash(1)))
+		require.NoError(t, db.Delete(leafHash(2)))
+		require.NoError(t, db.Put(leafHash(3), []byte{0xc2, 0x20, 0x01}))
+
+		trie, err = patricia.Open(root, db)
+		require.NoError(t, err)
+		violations, err := patricia.Validate(trie)
+		require.NoError(t, err)
+		require.Len(t, violations, 4)
+		var missing, mismatch, invalidRef int
+		for _, v := range violations {
+			switch {
+			case errors.Is(v, patricia.ErrMissingNode):
+				missing++
+			case errors.Is(v, patricia.ErrHashMismatch):
+				mismatch++
+			case errors.Is(v, patricia.ErrInvalidReference):
+				invalidRef++
+			}
+		}
+		require.Equal(t, 2, missing)
+		require.Equal(t, 1, mismatch)
+		require.Equal(t, 1, invalidRef)
+	})
+
+	t.Run("broken structure", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		leaf := storeNode(t, db, compact(t, []byte{1, 2, 3}, true), largeValue)
+		// an extension pointing to a leaf.
+		extToLeaf := storeNode(t, db, compact(t, []byte{4}, false), leaf)
+		// an extension with an empty path, pointing to an extension.
+		emptyExt := storeNode(t, db, compact(t, nil, false), extToLeaf)
+		// a branch with a single child.
+		var items [17]any
+		for i := range items {
+			items[i] = []byte{}
+		}
+		items[5] = emptyExt
+		single := storeNode(t, db, items[:]...)
+		// the root branch references a small node by hash.
+		small := storeNode(t, db, compact(t, []byte{1}, true), []byte{1})
+		items[5] = single
+		items[6] = small
+		root := storeNode(t, db, items[:]...)
+
+		trie, err := patricia.Open(root, db)
+		require.NoError(t, err)
+		violations, err := patricia.Validate(trie)
+		require.NoError(t, err)
+		var reported []string
+		for _, v := range violations {
+			reported = append(reported, v.Error())
+		}
+		require.ElementsMatch(t, []string{
+			"invalid extension node: child is a leaf at path [5 5]",
+			"invalid extension node: empty path at path [5 5]",
+			"invalid extension node: child is an extension at path [5 5]",
+			"invalid branch node: 1 entries at path [5]",
+			"invalid node reference: node of size 3 referenced by hash at path [6]",
+		}, reported)
+		require.ErrorIs(t, violations[0], violations[0].Err)
+	})
+
+	t.Run("unsupported trie", func(t *testing.T) {
+		_, err := patricia.Validate(nil)
+		require.ErrorIs(t, err, patricia.ErrUnsupportedTrie)
+	})
+}
@@ -0,0 +1,56 @@
+package patricia
+
+import (
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// StartRecording implements Recorder
+// From now on, every node that Get, Put, Delete (or any other operation)
+// touches is recorded in its state before the operation. This includes the
+// nodes that aren't on the path of a key but are needed to restructure the
+// trie, such as the remaining child of a branch that collapses on delete.
+// Calling StartRecording again discards the nodes recorded so far.
+func (m *mpt) StartRecording() {
+	m.witness = rawdb.NewMemoryDatabase()
+}
+
+// StopRecording implements Recorder
+// It returns the recorded nodes, keyed by their hash. Opening the trie with
+// the root it had when recording started on top of the witness, see Open,
+// and repeating the same operations results in the same root, without access
+// to any other part of the trie.
+// If the trie wasn't recording, nil is returned.
+func (m *mpt) StopRecording() (witness ethdb.KeyValueStore) {
+	witness, m.witness = m.witness, nil
+	return witness
+}
+
+// recordPath records the nodes on the path of nibbles, if recording is on.
+// These are exactly the nodes that Get, Put and Delete look at (except for
+// the siblings a delete needs, see record), since they follow the same path
+// as a proof.
+func (m *mpt) recordPath(nibbles []byte) error {
+	if m.witness == nil {
+		return nil
+	}
+	return m.prove(nibbles, m.witness)
+}
+
+// record records n, if recording is on. Nodes that are loaded from the
+// database are recorded by resolve.
+func (m *mpt) record(n mptNode) error {
+	if m.witness == nil {
+		return nil
+	}
+	switch n.(type) {
+	case nil, hashNode:
+		return nil
+	}
+	enc, err := serialize(n)
+	if err != nil {
+		return err
+	}
+	return m.witness.Put(crypto.Keccak256(enc), enc)
+}
@@ -0,0 +1,91 @@
+package patricia_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/butcher-of-blaviken/merkle/common"
+	"github.com/butcher-of-blaviken/merkle/patricia"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMPT_Recording(t *testing.T) {
+	key := func(i int) []byte {
+		return crypto.Keccak256([]byte(fmt.Sprint(i)))
+	}
+	// apply runs the same operations against a trie and returns the values
+	// read along the way.
+	apply := func(t *testing.T, trie common.MPT) (read [][]byte) {
+		for i := 0; i < 1000; i += 100 {
+			v, err := trie.Get(key(i))
+			require.NoError(t, err)
+			read = append(read, v)
+		}
+		_, err := trie.Get(key(5000))
+		require.ErrorIs(t, err, common.ErrKeyNotFound)
+		for i := 1; i < 1000; i += 97 {
+			require.NoError(t, trie.Put(key(i), []byte("changed")))
+		}
+		for i := 2000; i < 2010; i++ {
+			require.NoError(t, trie.Put(key(i), []byte("added")))
+		}
+		for i := 3; i < 1000; i += 37 {
+			require.NoError(t, trie.Delete(key(i)))
+		}
+		return read
+	}
+
+	check := func(t *testing.T, trie common.MPT) {
+		preRoot := trie.Root()
+		trie.(patricia.Recorder).StartRecording()
+		read := apply(t, trie)
+		postRoot := trie.Root()
+		witness := trie.(patricia.Recorder).StopRecording()
+		require.NotNil(t, witness)
+
+		// the witness holds a fraction of the trie.
+		nodes, _ := proofSize(t, witness)
+		require.Less(t, nodes, 500)
+
+		replay, err := patricia.Open(preRoot, witness)
+		require.NoError(t, err)
+		require.Equal(t, read, apply(t, replay))
+		require.Equal(t, postRoot, replay.Root())
+
+		// operations that weren't recorded can't be replayed.
+		replay, err = patricia.Open(preRoot, witness)
+		require.NoError(t, err)
+		_, err = replay.Get(key(500 + 50))
+		require.ErrorIs(t, err, patricia.ErrMissingNode)
+	}
+
+	t.Run("in memory", func(t *testing.T) {
+		trie := patricia.New()
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, trie.Put(key(i), key(i)))
+		}
+		check(t, trie)
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		db := rawdb.NewMemoryDatabase()
+		trie, err := patricia.Open(nil, db)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, trie.Put(key(i), key(i)))
+		}
+		root, err := trie.(patricia.Committer).Commit()
+		require.NoError(t, err)
+		trie, err = patricia.Open(root, db)
+		require.NoError(t, err)
+		check(t, trie)
+	})
+
+	t.Run("not recording", func(t *testing.T) {
+		trie := patricia.New()
+		require.NoError(t, trie.Put([]byte("key"), []byte("value")))
+		require.Nil(t, trie.(patricia.Recorder).StopRecording())
+	})
+}